@@ -1,19 +1,35 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Learner timezones must resolve without a system tz database
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	dbmigrate "lang-portal/internal/db"
+	"lang-portal/internal/events"
 	"lang-portal/internal/handlers"
+	"lang-portal/internal/logging"
+	"lang-portal/internal/metrics"
 	"lang-portal/internal/middleware"
 	"lang-portal/internal/models"
 	"lang-portal/internal/service"
+	"lang-portal/internal/tracing"
 )
 
 func main() {
+	// Log JSON lines; the stdlib log package writes through the same logger
+	slog.SetDefault(logging.New(os.Getenv("LOG_LEVEL")))
+
 	// Get database path from environment variable or use default
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
@@ -31,13 +47,75 @@ func main() {
 	}
 	defer db.Close()
 
+	// Record query durations and pool stats for /metrics
+	db.Observe(metrics.ObserveQuery)
+	metrics.RegisterDB(db.DB)
+
+	// Trace requests and SQL statements. OTEL_TRACES_EXPORTER is otlp, stdout
+	// or none, the default.
+	shutdownTracing, err := tracing.Setup(context.Background(), os.Getenv("OTEL_TRACES_EXPORTER"))
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
+	db.Observe(tracing.ObserveQuery)
+
+	// Apply pending migrations
+	migrationsPath := os.Getenv("MIGRATIONS_PATH")
+	if migrationsPath == "" {
+		migrationsPath = filepath.Join(".", "db", "migrations")
+	}
+	migrator := dbmigrate.NewMigrationManager(db.DB)
+	if err := migrator.Initialize(); err != nil {
+		log.Fatal("Failed to initialize migrations:", err)
+	}
+	migrations, err := migrator.LoadMigrations(migrationsPath)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if err := migrator.ApplyMigrations(migrations); err != nil {
+		log.Fatal("Failed to apply migrations:", err)
+	}
+
+	// Signer for the tokens handed to launched study activities
+	tokenTTL := 2 * time.Hour
+	if ttl := os.Getenv("SESSION_TOKEN_TTL"); ttl != "" {
+		if tokenTTL, err = time.ParseDuration(ttl); err != nil {
+			log.Fatal("Invalid SESSION_TOKEN_TTL:", err)
+		}
+	}
+	tokenSigner, err := service.NewSessionTokenSigner([]byte(os.Getenv("SESSION_TOKEN_SECRET")), tokenTTL)
+	if err != nil {
+		log.Fatal("Failed to create session token signer:", err)
+	}
 
 	// Initialize services
 	dashboardService := service.NewDashboardService(db)
 	wordService := service.NewWordService(db)
 	groupsService := service.NewGroupsService(db)
-	studyActivitiesService := service.NewStudyActivitiesService(db)
-	studySessionsService := service.NewStudySessionsService(db)
+	studyActivitiesService := service.NewStudyActivitiesService(db, tokenSigner)
+	studySessionsService := service.NewStudySessionsService(db, tokenSigner)
+	quizService := service.NewQuizService(db, studySessionsService)
+	sentencesService := service.NewSentencesService(db)
+	settingsService := service.NewSettingsService(db)
+	leechService := service.NewLeechService(db)
+	webhookService := service.NewWebhookService(db)
+	archiveService := service.NewArchiveService(db)
+	trashService := service.NewTrashService(db)
+
+	// Deliver events to webhooks in the background
+	go service.NewWebhookDispatcher(db).Run(context.Background(), events.Default)
+
+	// Purge the trash of what was deleted more than TRASH_RETENTION_DAYS ago
+	trashRetention := service.DefaultTrashRetention
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			log.Fatal("Invalid TRASH_RETENTION_DAYS:", value)
+		}
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+	go trashService.RunPurge(context.Background(), trashRetention, time.Hour)
 
 	// Initialize handlers
 	h := handlers.NewHandlers(
@@ -46,31 +124,148 @@ func main() {
 		groupsService,
 		studyActivitiesService,
 		studySessionsService,
+		quizService,
+		sentencesService,
+		settingsService,
+		leechService,
+		webhookService,
+		archiveService,
+		trashService,
 	)
 
 	// Create Gin router
-	r := gin.Default()
+	r := gin.New()
 
-	// Add middleware
+	// Add middleware. Logger comes first so it sees the final status and the
+	// request ID set by RequestID.
+	r.Use(middleware.Logger())
+	r.Use(middleware.Metrics())
+	r.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		// Probes and scrapes would drown out the traces of real requests
+		switch req.URL.Path {
+		case "/healthz", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	})))
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Recovery())
 	r.Use(middleware.ErrorHandler())
 
-	// Enable CORS
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// Client IPs come from X-Forwarded-For only behind TRUSTED_PROXIES
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// Browsers may call the API from CORS_ALLOWED_ORIGINS, a comma separated
+	// list in which https://*.example.com allows subdomains and * any origin.
+	// CORS comes before the limits so pages can read their 429 and 413 errors.
+	allowedOrigins := "http://localhost:5173,http://127.0.0.1:5173"
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		allowedOrigins = value
+	}
+	corsMaxAge := 10 * time.Minute
+	if value := os.Getenv("CORS_MAX_AGE"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("Invalid CORS_MAX_AGE:", err)
 		}
-		c.Next()
-	})
+		corsMaxAge = time.Duration(seconds) * time.Second
+	}
+	r.Use(middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins:   middleware.ParseOrigins(allowedOrigins),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Content-Type", "Authorization", "X-Session-Token", "X-Request-ID", "X-User-ID",
+			"If-None-Match", "If-Modified-Since",
+		},
+		ExposedHeaders: []string{
+			"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After",
+			"Deprecation", "Sunset", "Link", "ETag",
+		},
+		MaxAge: corsMaxAge,
+	}))
 
-	// Register routes
-	h.RegisterRoutes(r)
+	// Throttle clients and bound request bodies. Limits are RATE,BURST in
+	// requests per second, or off.
+	resetLimit := middleware.Limit{Rate: 10.0 / 60, Burst: 10}
+	r.Use(middleware.RateLimit(middleware.RateLimitConfig{
+		PerIP: middleware.RouteLimits{
+			Read:  limitFromEnv("RATE_LIMIT_IP_READ", middleware.Limit{Rate: 20, Burst: 60}),
+			Write: limitFromEnv("RATE_LIMIT_IP_WRITE", middleware.Limit{Rate: 5, Burst: 20}),
+			Reset: limitFromEnv("RATE_LIMIT_IP_RESET", resetLimit),
+		},
+		PerUser: middleware.RouteLimits{
+			Read:  limitFromEnv("RATE_LIMIT_USER_READ", middleware.Limit{Rate: 10, Burst: 40}),
+			Write: limitFromEnv("RATE_LIMIT_USER_WRITE", middleware.Limit{Rate: 3, Burst: 15}),
+			Reset: limitFromEnv("RATE_LIMIT_USER_RESET", resetLimit),
+		},
+	}))
+	maxBodyBytes := int64(1 << 20)
+	if value := os.Getenv("MAX_BODY_BYTES"); value != "" {
+		if maxBodyBytes, err = strconv.ParseInt(value, 10, 64); err != nil {
+			log.Fatal("Invalid MAX_BODY_BYTES:", err)
+		}
+	}
+	// Imports carry a whole archive, so they get a limit of their own
+	maxImportBytes := int64(64 << 20)
+	if value := os.Getenv("MAX_IMPORT_BYTES"); value != "" {
+		if maxImportBytes, err = strconv.ParseInt(value, 10, 64); err != nil {
+			log.Fatal("Invalid MAX_IMPORT_BYTES:", err)
+		}
+	}
+	r.Use(middleware.MaxBodySizes(maxBodyBytes, map[string]int64{"/import": maxImportBytes}))
+
+	// Liveness, readiness and version endpoints. Readiness fails when less
+	// than MIN_FREE_DISK_MB is left next to the database.
+	minFreeDiskMB := uint64(100)
+	if value := os.Getenv("MIN_FREE_DISK_MB"); value != "" {
+		if minFreeDiskMB, err = strconv.ParseUint(value, 10, 64); err != nil {
+			log.Fatal("Invalid MIN_FREE_DISK_MB:", err)
+		}
+	}
+	handlers.NewHealthHandler(db.DB, migrator, migrationsPath, dbDir, minFreeDiskMB<<20).RegisterRoutes(r)
 
-	log.Printf("Server starting on http://localhost:8081")
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Register routes. API v1 is retired on API_V1_SUNSET (YYYY-MM-DD).
+	v1Sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	if sunset := os.Getenv("API_V1_SUNSET"); sunset != "" {
+		if v1Sunset, err = time.Parse("2006-01-02", sunset); err != nil {
+			log.Fatal("Invalid API_V1_SUNSET:", err)
+		}
+	}
+	// Read endpoints answer If-None-Match from a counter of the writes, and
+	// with RESPONSE_CACHE_ENTRIES > 0 serve unchanged responses from memory
+	cacheEntries := 0
+	if value := os.Getenv("RESPONSE_CACHE_ENTRIES"); value != "" {
+		if cacheEntries, err = strconv.Atoi(value); err != nil {
+			log.Fatal("Invalid RESPONSE_CACHE_ENTRIES:", err)
+		}
+	}
+	h.RegisterRoutes(r, v1Sunset, middleware.NewConditional(db, cacheEntries))
+
+	slog.Info("server starting", "addr", "http://localhost:8081")
 	if err := r.Run(":8081"); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
-}
\ No newline at end of file
+}
+
+// limitFromEnv reads a rate limit from the environment variable name
+func limitFromEnv(name string, fallback middleware.Limit) middleware.Limit {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	limit, err := middleware.ParseLimit(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return limit
+}
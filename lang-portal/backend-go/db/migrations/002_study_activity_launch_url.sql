@@ -0,0 +1,2 @@
+-- Add launch URL template to study activities
+ALTER TABLE study_activities ADD COLUMN launch_url TEXT;
@@ -0,0 +1,11 @@
+-- Generalise words to any target language. Existing rows are Japanese.
+ALTER TABLE words RENAME COLUMN japanese TO term;
+ALTER TABLE words RENAME COLUMN romaji TO transliteration;
+ALTER TABLE words RENAME COLUMN english TO meaning;
+ALTER TABLE words ADD COLUMN language TEXT NOT NULL DEFAULT 'ja';
+
+-- Groups hold words of a single target language
+ALTER TABLE groups ADD COLUMN language TEXT NOT NULL DEFAULT 'ja';
+
+CREATE INDEX IF NOT EXISTS idx_words_language ON words(language);
+CREATE INDEX IF NOT EXISTS idx_groups_language ON groups(language);
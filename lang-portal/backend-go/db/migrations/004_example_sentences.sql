@@ -0,0 +1,13 @@
+-- Create example_sentences table
+CREATE TABLE IF NOT EXISTS example_sentences (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    word_id INTEGER NOT NULL,
+    sentence TEXT NOT NULL,
+    reading TEXT NOT NULL DEFAULT '',
+    translation TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (word_id) REFERENCES words(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_example_sentences_word_id ON example_sentences(word_id);
@@ -0,0 +1,19 @@
+-- Create user_settings table. The portal has a single learner, so it holds one row.
+CREATE TABLE IF NOT EXISTS user_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO user_settings (id) VALUES (1);
+
+-- Create daily_goals table. Each row applies from its local date until the next one.
+CREATE TABLE IF NOT EXISTS daily_goals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    goal_type TEXT NOT NULL CHECK (goal_type IN ('reviews', 'minutes')),
+    target INTEGER NOT NULL CHECK (target > 0),
+    effective_from TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_daily_goals_effective_from ON daily_goals(effective_from);
@@ -0,0 +1,12 @@
+-- Thresholds after which a word that is not yet learned counts as a leech
+ALTER TABLE user_settings ADD COLUMN leech_failure_threshold INTEGER NOT NULL DEFAULT 8;
+ALTER TABLE user_settings ADD COLUMN leech_lapse_threshold INTEGER NOT NULL DEFAULT 3;
+
+-- Groups are either static, with words added by hand, or kept up to date by
+-- the server. Leech groups hold the current leeches of their language.
+ALTER TABLE groups ADD COLUMN kind TEXT NOT NULL DEFAULT 'static';
+
+-- Group names are unique, so languages other than Japanese get a suffix.
+INSERT INTO groups (name, language, kind)
+SELECT CASE WHEN language = 'ja' THEN 'Trouble words' ELSE 'Trouble words (' || language || ')' END, language, 'leeches'
+FROM (SELECT language FROM words UNION SELECT language FROM groups);
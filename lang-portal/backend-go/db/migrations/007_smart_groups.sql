@@ -0,0 +1,14 @@
+-- Smart groups have kind 'smart' and select their words with rules, stored
+-- as a JSON array, when they are read
+ALTER TABLE groups ADD COLUMN rules TEXT;
+
+-- Rules can select recently added words
+ALTER TABLE words ADD COLUMN created_at DATETIME;
+UPDATE words SET created_at = CURRENT_TIMESTAMP;
+
+CREATE TRIGGER IF NOT EXISTS words_created_at
+AFTER INSERT ON words
+WHEN NEW.created_at IS NULL
+BEGIN
+    UPDATE words SET created_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
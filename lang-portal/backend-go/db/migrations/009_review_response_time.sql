@@ -0,0 +1,3 @@
+-- How long the learner took to answer, in milliseconds, when the study
+-- activity reported it
+ALTER TABLE word_review_items ADD COLUMN response_time_ms INTEGER;
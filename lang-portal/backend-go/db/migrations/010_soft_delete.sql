@@ -0,0 +1,16 @@
+-- Deleted rows stay in the trash, where they can be restored, until they
+-- are purged after the retention period. Rows are deleted when deleted_at
+-- is set.
+ALTER TABLE words ADD COLUMN deleted_at DATETIME;
+ALTER TABLE groups ADD COLUMN deleted_at DATETIME;
+ALTER TABLE study_sessions ADD COLUMN deleted_at DATETIME;
+ALTER TABLE study_activities ADD COLUMN deleted_at DATETIME;
+
+-- Reviews are deleted with their word or study session, at the time of the
+-- latest of the two, so they are purged with the last of them
+ALTER TABLE word_review_items ADD COLUMN deleted_at DATETIME;
+
+-- Resetting the study history archives sessions and reviews. Archived rows
+-- are deleted but stay out of the trash and are never purged on their own.
+ALTER TABLE study_sessions ADD COLUMN archived_at DATETIME;
+ALTER TABLE word_review_items ADD COLUMN archived_at DATETIME;
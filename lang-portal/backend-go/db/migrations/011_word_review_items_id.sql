@@ -0,0 +1,26 @@
+-- A word can be reviewed more than once in a study session, e.g. when a quiz
+-- is retaken, so reviews get their own id instead of the (word_id,
+-- study_session_id) key of the initial schema. Existing reviews keep their
+-- rowids, so their order is unchanged.
+CREATE TABLE word_review_items_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    word_id INTEGER NOT NULL,
+    study_session_id INTEGER NOT NULL,
+    correct BOOLEAN NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    response_time_ms INTEGER,
+    deleted_at DATETIME,
+    archived_at DATETIME,
+    FOREIGN KEY (word_id) REFERENCES words(id),
+    FOREIGN KEY (study_session_id) REFERENCES study_sessions(id)
+);
+
+INSERT INTO word_review_items_new (id, word_id, study_session_id, correct, created_at, response_time_ms, deleted_at, archived_at)
+SELECT rowid, word_id, study_session_id, correct, created_at, response_time_ms, deleted_at, archived_at
+FROM word_review_items;
+
+DROP TABLE word_review_items;
+ALTER TABLE word_review_items_new RENAME TO word_review_items;
+
+CREATE INDEX IF NOT EXISTS idx_word_review_items_word_id ON word_review_items(word_id);
+CREATE INDEX IF NOT EXISTS idx_word_review_items_study_session_id ON word_review_items(study_session_id);
@@ -1,34 +1,34 @@
 -- Insert basic groups
-INSERT INTO groups (name) VALUES
-    ('Basic Greetings'),
-    ('Numbers'),
-    ('Colors'),
-    ('Family Members');
+INSERT INTO groups (name, language) VALUES
+    ('Basic Greetings', 'ja'),
+    ('Numbers', 'ja'),
+    ('Colors', 'ja'),
+    ('Family Members', 'ja');
 
 -- Insert some basic Japanese words
-INSERT INTO words (japanese, romaji, english, parts) VALUES
-    ('こんにちは', 'konnichiwa', 'hello', '{"type": "greeting", "formality": "neutral"}'),
-    ('さようなら', 'sayounara', 'goodbye', '{"type": "greeting", "formality": "formal"}'),
-    ('おはよう', 'ohayou', 'good morning', '{"type": "greeting", "formality": "informal"}'),
-    ('一', 'ichi', 'one', '{"type": "number", "category": "cardinal"}'),
-    ('二', 'ni', 'two', '{"type": "number", "category": "cardinal"}'),
-    ('三', 'san', 'three', '{"type": "number", "category": "cardinal"}'),
-    ('赤', 'aka', 'red', '{"type": "color", "category": "basic"}'),
-    ('青', 'ao', 'blue', '{"type": "color", "category": "basic"}'),
-    ('黄色', 'kiiro', 'yellow', '{"type": "color", "category": "basic"}'),
-    ('お父さん', 'otousan', 'father', '{"type": "family", "formality": "polite"}'),
-    ('お母さん', 'okaasan', 'mother', '{"type": "family", "formality": "polite"}'),
-    ('兄', 'ani', 'older brother', '{"type": "family", "formality": "plain"}');
+INSERT INTO words (language, term, transliteration, meaning) VALUES
+    ('ja', 'こんにちは', 'konnichiwa', 'hello'),
+    ('ja', 'さようなら', 'sayounara', 'goodbye'),
+    ('ja', 'おはよう', 'ohayou', 'good morning'),
+    ('ja', '一', 'ichi', 'one'),
+    ('ja', '二', 'ni', 'two'),
+    ('ja', '三', 'san', 'three'),
+    ('ja', '赤', 'aka', 'red'),
+    ('ja', '青', 'ao', 'blue'),
+    ('ja', '黄色', 'kiiro', 'yellow'),
+    ('ja', 'お父さん', 'otousan', 'father'),
+    ('ja', 'お母さん', 'okaasan', 'mother'),
+    ('ja', '兄', 'ani', 'older brother');
 
 -- Link words to groups
 INSERT INTO words_groups (word_id, group_id) 
 SELECT w.id, g.id 
 FROM words w, groups g 
 WHERE 
-    (w.japanese IN ('こんにちは', 'さようなら', 'おはよう') AND g.name = 'Basic Greetings')
-    OR (w.japanese IN ('一', '二', '三') AND g.name = 'Numbers')
-    OR (w.japanese IN ('赤', '青', '黄色') AND g.name = 'Colors')
-    OR (w.japanese IN ('お父さん', 'お母さん', '兄') AND g.name = 'Family Members');
+    (w.term IN ('こんにちは', 'さようなら', 'おはよう') AND g.name = 'Basic Greetings')
+    OR (w.term IN ('一', '二', '三') AND g.name = 'Numbers')
+    OR (w.term IN ('赤', '青', '黄色') AND g.name = 'Colors')
+    OR (w.term IN ('お父さん', 'お母さん', '兄') AND g.name = 'Family Members');
 
 -- Insert a study activity
 INSERT INTO study_activities (id, name, thumbnail_url, description) VALUES
@@ -48,5 +48,5 @@ INSERT INTO word_review_items (word_id, study_session_id, correct)
 SELECT w.id, s.id, (RANDOM() > 0.5)
 FROM words w
 CROSS JOIN study_sessions s
-WHERE w.japanese IN ('こんにちは', 'さようなら', '一', '二')
+WHERE w.term IN ('こんにちは', 'さようなら', '一', '二')
 LIMIT 8;
\ No newline at end of file
@@ -1,13 +1,13 @@
 -- Insert test words with specific IDs
-INSERT INTO words (id, japanese, romaji, english) VALUES
-(1, '犬', 'inu', 'dog'),
-(2, '猫', 'neko', 'cat'),
-(3, '鳥', 'tori', 'bird');
+INSERT INTO words (id, language, term, transliteration, meaning) VALUES
+(1, 'ja', '犬', 'inu', 'dog'),
+(2, 'ja', '猫', 'neko', 'cat'),
+(3, 'ja', '鳥', 'tori', 'bird');
 
 -- Insert test groups with specific IDs
-INSERT INTO groups (id, name) VALUES
-(1, 'Animals'),
-(2, 'Basic Words');
+INSERT INTO groups (id, name, language) VALUES
+(1, 'Animals', 'ja'),
+(2, 'Basic Words', 'ja');
 
 -- Insert test word-group relationships
 INSERT INTO words_groups (word_id, group_id) VALUES
@@ -1,10 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -72,19 +73,27 @@ func (m *MigrationManager) LoadMigrations(migrationsDir string) ([]Migration, er
 		return migrations[i].ID < migrations[j].ID
 	})
 
+	// Applied migrations are recorded by ID, so a second file with the same
+	// ID would be skipped without notice
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].ID == migrations[i-1].ID {
+			return nil, fmt.Errorf("migrations %s and %s have the same ID %d", migrations[i-1].Name, migrations[i].Name, migrations[i].ID)
+		}
+	}
+
 	return migrations, nil
 }
 
 // ApplyMigrations applies all pending migrations
 func (m *MigrationManager) ApplyMigrations(migrations []Migration) error {
 	for _, migration := range migrations {
-		applied, err := m.isMigrationApplied(migration.ID)
+		applied, err := m.isMigrationApplied(context.Background(), migration.ID)
 		if err != nil {
 			return err
 		}
 
 		if !applied {
-			log.Printf("Applying migration: %s", migration.Name)
+			slog.Info("applying migration", "name", migration.Name)
 			
 			tx, err := m.db.Begin()
 			if err != nil {
@@ -110,10 +119,25 @@ func (m *MigrationManager) ApplyMigrations(migrations []Migration) error {
 	return nil
 }
 
+// PendingMigrations returns the migrations that have not been applied yet
+func (m *MigrationManager) PendingMigrations(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	var pending []Migration
+	for _, migration := range migrations {
+		applied, err := m.isMigrationApplied(ctx, migration.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
 // isMigrationApplied checks if a migration has already been applied
-func (m *MigrationManager) isMigrationApplied(id int) (bool, error) {
+func (m *MigrationManager) isMigrationApplied(ctx context.Context, id int) (bool, error) {
 	var count int
-	err := m.db.QueryRow("SELECT COUNT(*) FROM migrations WHERE id = ?", id).Scan(&count)
+	err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM migrations WHERE id = ?", id).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	migrator := NewMigrationManager(conn)
+	if err := migrator.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize migrations: %v", err)
+	}
+	migrations := []Migration{
+		{ID: 1, Name: "001_words.sql", Content: "CREATE TABLE words (id INTEGER PRIMARY KEY)"},
+		{ID: 2, Name: "002_groups.sql", Content: "CREATE TABLE groups (id INTEGER PRIMARY KEY)"},
+	}
+	if err := migrator.ApplyMigrations(migrations[:1]); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	pending, err := migrator.PendingMigrations(context.Background(), migrations)
+	if err != nil {
+		t.Fatalf("Failed to list pending migrations: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Name != "002_groups.sql" {
+		t.Errorf("Expected 002_groups.sql to be pending; got %+v", pending)
+	}
+}
+
+func TestLoadMigrationsRejectsDuplicateIDs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0001_init.sql", "001_initial_schema.sql", "002_groups.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1"), 0o644); err != nil {
+			t.Fatalf("Failed to write migration: %v", err)
+		}
+	}
+
+	_, err := NewMigrationManager(nil).LoadMigrations(dir)
+	if err == nil || !strings.Contains(err.Error(), "same ID 1") {
+		t.Errorf("Expected the duplicate ID to be rejected; got %v", err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := NewMigrationManager(nil).LoadMigrations(filepath.Join("..", "..", "db", "migrations"))
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Error("Expected the migrations of the repository to load")
+	}
+}
+
+func TestReviewIDMigrationKeepsReviews(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	migrator := NewMigrationManager(conn)
+	if err := migrator.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize migrations: %v", err)
+	}
+	migrations, err := migrator.LoadMigrations(filepath.Join("..", "..", "db", "migrations"))
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	var before []Migration
+	for _, migration := range migrations {
+		if migration.ID < 11 {
+			before = append(before, migration)
+		}
+	}
+	if err := migrator.ApplyMigrations(before); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+	if _, err := conn.Exec(`
+		INSERT INTO word_review_items (word_id, study_session_id, correct, response_time_ms, archived_at)
+		VALUES (1, 1, 1, 1200, NULL), (2, 1, 0, NULL, CURRENT_TIMESTAMP)
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+	if err := migrator.ApplyMigrations(migrations); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	// The same word can now be reviewed again in the session
+	if _, err := conn.Exec(`INSERT INTO word_review_items (word_id, study_session_id, correct) VALUES (1, 1, 0)`); err != nil {
+		t.Fatalf("Failed to review the word again: %v", err)
+	}
+	var count, archived, timed int
+	if err := conn.QueryRow(`
+		SELECT COUNT(*), COUNT(archived_at), COUNT(CASE WHEN id = 1 AND response_time_ms = 1200 THEN 1 END)
+		FROM word_review_items
+	`).Scan(&count, &archived, &timed); err != nil {
+		t.Fatalf("Failed to count reviews: %v", err)
+	}
+	if count != 3 || archived != 1 || timed != 1 {
+		t.Errorf("Got %d reviews, %d archived and %d timed; want 3, 1 and 1", count, archived, timed)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+
+	"lang-portal/internal/kana"
+	"lang-portal/internal/models"
 )
 
 type SeedConfig struct {
@@ -15,6 +18,7 @@ type SeedConfig struct {
 
 type GroupConfig struct {
 	Name       string `json:"name"`
+	Language   string `json:"language"`
 	SourceFile string `json:"source_file"`
 }
 
@@ -22,12 +26,31 @@ type StudyActivityConfig struct {
 	Name         string `json:"name"`
 	ThumbnailURL string `json:"thumbnail_url"`
 	Description  string `json:"description"`
+	LaunchURL    string `json:"launch_url"`
 }
 
+// Word is an entry of a group's source file. Japanese files may use the
+// japanese, romaji and english keys in place of term, transliteration and meaning.
 type Word struct {
-	Japanese string `json:"japanese"`
-	Romaji   string `json:"romaji"`
-	English  string `json:"english"`
+	Term            string `json:"term"`
+	Transliteration string `json:"transliteration"`
+	Meaning         string `json:"meaning"`
+	Japanese        string `json:"japanese"`
+	Romaji          string `json:"romaji"`
+	English         string `json:"english"`
+}
+
+// normalize moves the legacy Japanese keys into the generic fields
+func (w *Word) normalize() {
+	if w.Term == "" {
+		w.Term = w.Japanese
+	}
+	if w.Transliteration == "" {
+		w.Transliteration = w.Romaji
+	}
+	if w.Meaning == "" {
+		w.Meaning = w.English
+	}
 }
 
 type Seeder struct {
@@ -82,8 +105,8 @@ func (s *Seeder) LoadAndSeed() error {
 
 func (s *Seeder) seedStudyActivities(tx *sql.Tx, activities []StudyActivityConfig) error {
 	stmt, err := tx.Prepare(`
-		INSERT INTO study_activities (name, thumbnail_url, description)
-		VALUES (?, ?, ?)
+		INSERT INTO study_activities (name, thumbnail_url, description, launch_url)
+		VALUES (?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -91,7 +114,7 @@ func (s *Seeder) seedStudyActivities(tx *sql.Tx, activities []StudyActivityConfi
 	defer stmt.Close()
 
 	for _, activity := range activities {
-		if _, err := stmt.Exec(activity.Name, activity.ThumbnailURL, activity.Description); err != nil {
+		if _, err := stmt.Exec(activity.Name, activity.ThumbnailURL, activity.Description, activity.LaunchURL); err != nil {
 			return err
 		}
 	}
@@ -101,8 +124,8 @@ func (s *Seeder) seedStudyActivities(tx *sql.Tx, activities []StudyActivityConfi
 func (s *Seeder) seedGroups(tx *sql.Tx, groups []GroupConfig) error {
 	// Prepare statements
 	groupStmt, err := tx.Prepare(`
-		INSERT INTO groups (name)
-		VALUES (?)
+		INSERT INTO groups (name, language)
+		VALUES (?, ?)
 		RETURNING id
 	`)
 	if err != nil {
@@ -111,8 +134,8 @@ func (s *Seeder) seedGroups(tx *sql.Tx, groups []GroupConfig) error {
 	defer groupStmt.Close()
 
 	wordStmt, err := tx.Prepare(`
-		INSERT INTO words (japanese, romaji, english)
-		VALUES (?, ?, ?)
+		INSERT INTO words (term, transliteration, meaning, language)
+		VALUES (?, ?, ?, ?)
 		RETURNING id
 	`)
 	if err != nil {
@@ -131,9 +154,13 @@ func (s *Seeder) seedGroups(tx *sql.Tx, groups []GroupConfig) error {
 
 	// Process each group
 	for _, group := range groups {
+		if group.Language == "" {
+			group.Language = models.LanguageJapanese
+		}
+
 		// Insert group
 		var groupID int
-		if err := groupStmt.QueryRow(group.Name).Scan(&groupID); err != nil {
+		if err := groupStmt.QueryRow(group.Name, group.Language).Scan(&groupID); err != nil {
 			return fmt.Errorf("failed to insert group %s: %v", group.Name, err)
 		}
 
@@ -151,13 +178,23 @@ func (s *Seeder) seedGroups(tx *sql.Tx, groups []GroupConfig) error {
 
 		// Insert words and create relationships
 		for _, word := range words {
+			word.normalize()
+			if group.Language == models.LanguageJapanese {
+				romaji, err := resolveRomaji(word)
+				if err != nil {
+					return fmt.Errorf("invalid word in %s: %v", group.SourceFile, err)
+				}
+				word.Transliteration = romaji
+			}
+
 			var wordID int
 			if err := wordStmt.QueryRow(
-				word.Japanese,
-				word.Romaji,
-				word.English,
+				word.Term,
+				word.Transliteration,
+				word.Meaning,
+				group.Language,
 			).Scan(&wordID); err != nil {
-				return fmt.Errorf("failed to insert word %s: %v", word.Japanese, err)
+				return fmt.Errorf("failed to insert word %s: %v", word.Term, err)
 			}
 
 			if _, err := wordGroupStmt.Exec(wordID, groupID); err != nil {
@@ -167,4 +204,22 @@ func (s *Seeder) seedGroups(tx *sql.Tx, groups []GroupConfig) error {
 	}
 
 	return nil
+}
+
+// resolveRomaji fills in a missing romaji reading from a kana-only Japanese
+// term and rejects romaji that does not match it. The particles are written
+// as they are read, so こんにちは gets "konnichiwa". Readings of words written
+// with kanji cannot be derived, so those must be provided and are kept as is.
+func resolveRomaji(word Word) (string, error) {
+	if word.Transliteration == "" {
+		if !kana.IsKana(word.Term) {
+			return "", fmt.Errorf("word %s has no romaji and its reading cannot be derived", word.Term)
+		}
+		return kana.FoldParticles(kana.ToRomaji(word.Term)), nil
+	}
+
+	if kana.IsKana(word.Term) && !kana.ReadingMatches(word.Term, word.Transliteration) {
+		return "", fmt.Errorf("romaji %q does not match %s (expected %q)", word.Transliteration, word.Term, kana.ToRomaji(word.Term))
+	}
+	return word.Transliteration, nil
 }
\ No newline at end of file
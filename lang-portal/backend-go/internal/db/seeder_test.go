@@ -0,0 +1,41 @@
+package db
+
+import "testing"
+
+func TestWordNormalize(t *testing.T) {
+	word := Word{Japanese: "こんにちは", Romaji: "konnichiwa", English: "hello"}
+	word.normalize()
+	if word.Term != "こんにちは" || word.Transliteration != "konnichiwa" || word.Meaning != "hello" {
+		t.Errorf("Expected legacy keys to fill the generic fields; got %+v", word)
+	}
+}
+
+func TestResolveRomaji(t *testing.T) {
+	romaji, err := resolveRomaji(Word{Term: "ありがとう", Meaning: "thank you"})
+	if err != nil || romaji != "arigatou" {
+		t.Errorf("Expected romaji to be filled in; got %q, %v", romaji, err)
+	}
+
+	romaji, err = resolveRomaji(Word{Term: "こんにちは", Meaning: "hello"})
+	if err != nil || romaji != "konnichiwa" {
+		t.Errorf("Expected the particle to be filled in as it is read; got %q, %v", romaji, err)
+	}
+
+	romaji, err = resolveRomaji(Word{Term: "こんにちは", Transliteration: "konnichiwa"})
+	if err != nil || romaji != "konnichiwa" {
+		t.Errorf("Expected provided romaji to be kept; got %q, %v", romaji, err)
+	}
+
+	if _, err := resolveRomaji(Word{Term: "さようなら", Transliteration: "ohayou"}); err == nil {
+		t.Errorf("Expected an error for inconsistent romaji")
+	}
+
+	if _, err := resolveRomaji(Word{Term: "犬"}); err == nil {
+		t.Errorf("Expected an error for missing romaji on a kanji word")
+	}
+
+	romaji, err = resolveRomaji(Word{Term: "犬", Transliteration: "inu"})
+	if err != nil || romaji != "inu" {
+		t.Errorf("Expected romaji of a kanji word to be kept; got %q, %v", romaji, err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package events is the in-process bus the services publish their writes
+// on, e.g. so open dashboards can be updated without reloading.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ReviewRecorded   = "review.recorded"
+	SessionStarted   = "session.started"
+	SessionCompleted = "session.completed"
+	StreakExtended   = "streak.extended"
+	WordUpdated      = "word.updated"
+	GroupCreated     = "group.created"
+	GroupUpdated     = "group.updated"
+	GroupDeleted     = "group.deleted"
+	SettingsUpdated  = "settings.updated"
+	HistoryReset     = "history.reset"
+	DataReset        = "data.reset"
+	DataImported     = "data.imported"
+)
+
+// Types lists every event type
+var Types = []string{
+	ReviewRecorded, SessionStarted, SessionCompleted, StreakExtended,
+	WordUpdated, GroupCreated, GroupUpdated, GroupDeleted,
+	SettingsUpdated, HistoryReset, DataReset, DataImported,
+}
+
+// Event is a change published on a Bus. Events of a learner carry their
+// User; events about shared data, like words and groups, have none.
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	User string      `json:"user,omitempty"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// ForUser is the filter of the events user may see: their own and the
+// shared ones
+func ForUser(user string) func(Event) bool {
+	return func(e Event) bool {
+		return e.User == "" || e.User == user
+	}
+}
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// it is dropped
+const subscriptionBuffer = 64
+
+// Subscription receives the events of a Bus that pass its filter. C is
+// closed when the subscription is cancelled or falls behind.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	filter func(Event) bool
+	bus    *Bus
+}
+
+// Cancel stops the subscription
+func (s *Subscription) Cancel() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+// Bus delivers events to its subscribers and keeps the latest ones, so
+// subscribers can catch up on what they missed
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBus keeps the last historySize events. Event IDs start at the current
+// time in microseconds, so IDs of a later run are higher than those before.
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		nextID:      uint64(time.Now().UnixMicro()),
+		historySize: historySize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Default is the bus the services publish on
+var Default = NewBus(1000)
+
+// Publish sends an event about the learner of ctx on the default bus
+func Publish(ctx context.Context, eventType string, data interface{}) Event {
+	return Default.Publish(eventType, UserFromContext(ctx), data)
+}
+
+// PublishShared sends an event about shared data to every subscriber of the
+// default bus
+func PublishShared(eventType string, data interface{}) Event {
+	return Default.Publish(eventType, "", data)
+}
+
+// Publish sends an event of user, or a shared one if user is empty
+func (b *Bus) Publish(eventType, user string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := Event{ID: b.nextID, Type: eventType, User: user, Time: time.Now().UTC(), Data: data}
+	b.nextID++
+	b.history = append(b.history, e)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for s := range b.subscribers {
+		if !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			// A slow subscriber must not hold up the writers. It can
+			// resume from the history with the ID of its last event.
+			b.drop(s)
+		}
+	}
+	return e
+}
+
+// Subscribe starts receiving the events that pass filter. With a lastID
+// other than 0 it also returns the events published since, and whether they
+// are complete; they are not when lastID is older than the history.
+func (b *Bus) Subscribe(lastID uint64, filter func(Event) bool) (*Subscription, []Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, filter: filter, bus: b}
+	b.subscribers[s] = struct{}{}
+
+	if lastID == 0 {
+		return s, nil, true
+	}
+	oldest := b.nextID
+	if len(b.history) > 0 {
+		oldest = b.history[0].ID
+	}
+	complete := lastID+1 >= oldest && lastID < b.nextID
+	var missed []Event
+	for _, e := range b.history {
+		if e.ID > lastID && filter(e) {
+			missed = append(missed, e)
+		}
+	}
+	return s, missed, complete
+}
+
+func (b *Bus) drop(s *Subscription) {
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+type userKey struct{}
+
+// NewUserContext returns a copy of ctx that carries the learner user
+func NewUserContext(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the learner of ctx, or an empty string
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// WriteSSE writes e as a server-sent event named after its type
+func WriteSSE(w io.Writer, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
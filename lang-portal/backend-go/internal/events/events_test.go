@@ -0,0 +1,84 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus(3)
+	alice, _, _ := bus.Subscribe(0, ForUser("alice"))
+	defer alice.Cancel()
+
+	first := bus.Publish(ReviewRecorded, "alice", nil)
+	bus.Publish(ReviewRecorded, "bob", nil)
+	shared := bus.Publish(GroupCreated, "", map[string]interface{}{"id": 7})
+
+	for _, want := range []Event{first, shared} {
+		if got := <-alice.C; got.ID != want.ID || got.Type != want.Type {
+			t.Errorf("Received %+v; want %+v", got, want)
+		}
+	}
+	select {
+	case e := <-alice.C:
+		t.Errorf("Expected bob's review to be filtered; got %+v", e)
+	default:
+	}
+
+	// Reconnecting with the last event ID catches up from the history
+	resumed, missed, complete := bus.Subscribe(first.ID, ForUser("alice"))
+	resumed.Cancel()
+	if !complete || len(missed) != 1 || missed[0].ID != shared.ID {
+		t.Errorf("Expected to catch up on the shared event; got %+v, complete %v", missed, complete)
+	}
+
+	// The history keeps 3 events, so the first one has been forgotten
+	bus.Publish(SessionStarted, "alice", nil)
+	bus.Publish(SessionStarted, "alice", nil)
+	resumed, _, complete = bus.Subscribe(first.ID, ForUser("alice"))
+	resumed.Cancel()
+	if complete {
+		t.Error("Expected an incomplete history after the first event was dropped")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	bus := NewBus(10)
+	slow, _, _ := bus.Subscribe(0, ForUser(""))
+	for i := 0; i <= subscriptionBuffer; i++ {
+		bus.Publish(WordUpdated, "", nil)
+	}
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != subscriptionBuffer {
+		t.Errorf("Expected %d buffered events before the channel closed; got %d", subscriptionBuffer, received)
+	}
+	// Cancelling a dropped subscription is harmless
+	slow.Cancel()
+}
+
+func TestPublishUsesContextUser(t *testing.T) {
+	sub, _, _ := Default.Subscribe(0, func(e Event) bool { return e.Type == ReviewRecorded })
+	defer sub.Cancel()
+
+	Publish(NewUserContext(context.Background(), "alice"), ReviewRecorded, nil)
+	if e := <-sub.C; e.User != "alice" {
+		t.Errorf("Event user = %q; want alice", e.User)
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	e := Event{ID: 42, Type: ReviewRecorded, Data: map[string]interface{}{"word_id": 1}}
+	if err := WriteSSE(&buf, e); err != nil {
+		t.Fatalf("Failed to write event: %v", err)
+	}
+	got := buf.String()
+	if !strings.HasPrefix(got, "id: 42\nevent: review.recorded\ndata: {") || !strings.HasSuffix(got, "}\n\n") {
+		t.Errorf("Unexpected event encoding %q", got)
+	}
+}
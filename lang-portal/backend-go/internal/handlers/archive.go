@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"lang-portal/internal/logging"
+	"lang-portal/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handlers) Export(c *gin.Context) {
+	filename := fmt.Sprintf("lang-portal-%s.json", time.Now().UTC().Format("2006-01-02"))
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	if err := h.archive.Export(c.Writer); err != nil {
+		// Once the archive is being sent the error can only be logged; the
+		// client is left with a truncated archive that fails to import
+		if c.Writer.Written() {
+			logging.FromContext(c.Request.Context()).Error("export failed", "error", err)
+			return
+		}
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *Handlers) Import(c *gin.Context) {
+	onConflict := c.DefaultQuery("on_conflict", service.ImportSkip)
+	result, err := h.archive.Import(c.Request.Body, onConflict)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit),
+			})
+		case strings.HasPrefix(err.Error(), "invalid"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "import conflict"):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
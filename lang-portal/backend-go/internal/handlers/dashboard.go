@@ -16,7 +16,7 @@ func NewDashboardHandler(service *service.DashboardService) *DashboardHandler {
 }
 
 func (h *DashboardHandler) GetLastStudySession(c *gin.Context) {
-	session, err := h.service.GetLastStudySession()
+	session, err := h.service.GetLastStudySession(c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -25,7 +25,7 @@ func (h *DashboardHandler) GetLastStudySession(c *gin.Context) {
 }
 
 func (h *DashboardHandler) GetStudyProgress(c *gin.Context) {
-	progress, err := h.service.GetStudyProgress()
+	progress, err := h.service.GetStudyProgress(c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -34,7 +34,7 @@ func (h *DashboardHandler) GetStudyProgress(c *gin.Context) {
 }
 
 func (h *DashboardHandler) GetQuickStats(c *gin.Context) {
-	stats, err := h.service.GetQuickStats()
+	stats, err := h.service.GetQuickStats(c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
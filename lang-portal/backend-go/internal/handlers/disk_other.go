@@ -0,0 +1,7 @@
+//go:build !unix
+
+package handlers
+
+func freeDiskBytes(path string) (uint64, error) {
+	return 0, errDiskUnsupported
+}
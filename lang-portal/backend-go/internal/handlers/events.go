@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"lang-portal/internal/events"
+	"lang-portal/internal/middleware"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment, so
+// proxies do not close it
+const eventsHeartbeat = 15 * time.Second
+
+// GetEvents streams the events of the learner and of shared data as
+// server-sent events. Browsers cannot set headers on an EventSource, so the
+// learner may also be passed as ?user=. A reconnecting client gets the
+// events since its Last-Event-ID, or a resync event when they are no longer
+// known and it should reload instead.
+func (h *Handlers) GetEvents(c *gin.Context) {
+	user := middleware.User(c)
+	if user == "" {
+		user = c.Query("user")
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	subscription, missed, complete := events.Default.Subscribe(lastID, events.ForUser(user))
+	defer subscription.Cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	io.WriteString(c.Writer, "retry: 3000\n\n")
+	if !complete {
+		io.WriteString(c.Writer, "event: resync\ndata: {}\n\n")
+	}
+	for _, e := range missed {
+		if err := events.WriteSSE(c.Writer, e); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-subscription.C:
+			if !ok {
+				// Fell behind; the client resumes from its last event
+				return
+			}
+			if err := events.WriteSSE(c.Writer, e); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
 	"strconv"
@@ -8,6 +9,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"lang-portal/internal/events"
+	"lang-portal/internal/kana"
+	"lang-portal/internal/middleware"
+	"lang-portal/internal/models"
 	"lang-portal/internal/service"
 )
 
@@ -17,6 +22,13 @@ type Handlers struct {
 	groups         *service.GroupsService
 	studyActivities *service.StudyActivitiesService
 	studySessions  *service.StudySessionsService
+	quiz           *service.QuizService
+	sentences      *service.SentencesService
+	settings       *service.SettingsService
+	leeches        *service.LeechService
+	webhooks       *service.WebhookService
+	archive        *service.ArchiveService
+	trash          *service.TrashService
 }
 
 func NewHandlers(
@@ -25,6 +37,13 @@ func NewHandlers(
 	groups *service.GroupsService,
 	studyActivities *service.StudyActivitiesService,
 	studySessions *service.StudySessionsService,
+	quiz *service.QuizService,
+	sentences *service.SentencesService,
+	settings *service.SettingsService,
+	leeches *service.LeechService,
+	webhooks *service.WebhookService,
+	archive *service.ArchiveService,
+	trash *service.TrashService,
 ) *Handlers {
 	return &Handlers{
 		dashboard:       dashboard,
@@ -32,50 +51,153 @@ func NewHandlers(
 		groups:         groups,
 		studyActivities: studyActivities,
 		studySessions:  studySessions,
+		quiz:           quiz,
+		sentences:      sentences,
+		settings:       settings,
+		leeches:        leeches,
+		webhooks:       webhooks,
+		archive:        archive,
+		trash:          trash,
 	}
 }
 
-func (h *Handlers) RegisterRoutes(r *gin.Engine) {
-	api := r.Group("/api")
+// clockWindow is how long responses that depend on the current time, like
+// streaks and smart groups, are revalidated from the data version alone
+const clockWindow = time.Minute
+
+// RegisterRoutes mounts the API under /api/v1 and /api/v2. The unversioned
+// /api prefix stays an alias of v1 for existing clients. v1 is deprecated and
+// its responses announce v1Sunset. Read endpoints are answered with 304 or
+// from the cache of cond while the data is unchanged.
+func (h *Handlers) RegisterRoutes(r *gin.Engine, v1Sunset time.Time, cond *middleware.Conditional) {
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		h.registerRoutes(r.Group(prefix, middleware.Deprecation(v1Sunset, prefix, "/api/v2")), h.v1Handlers(), cond)
+	}
+	h.registerRoutes(r.Group("/api/v2"), h.v2Handlers(), cond)
+}
+
+// handle runs handler with services bound to the request context, so their
+// logs and SQL errors carry the request ID and their events the learner
+func (h *Handlers) handle(handler func(*Handlers, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler(h.withContext(events.NewUserContext(c.Request.Context(), middleware.User(c))), c)
+	}
+}
+
+func (h *Handlers) withContext(ctx context.Context) *Handlers {
+	return &Handlers{
+		dashboard:       h.dashboard.WithContext(ctx),
+		words:           h.words.WithContext(ctx),
+		groups:          h.groups.WithContext(ctx),
+		studyActivities: h.studyActivities.WithContext(ctx),
+		studySessions:   h.studySessions.WithContext(ctx),
+		quiz:            h.quiz.WithContext(ctx),
+		sentences:       h.sentences.WithContext(ctx),
+		settings:        h.settings.WithContext(ctx),
+		leeches:         h.leeches.WithContext(ctx),
+		webhooks:        h.webhooks.WithContext(ctx),
+		archive:         h.archive.WithContext(ctx),
+		trash:           h.trash.WithContext(ctx),
+	}
+}
+
+func (h *Handlers) registerRoutes(api *gin.RouterGroup, versioned versionedHandlers, cond *middleware.Conditional) {
+	// Quizzes are shuffled with a fresh seed on every request, so they are not
+	// cached
+	data := cond.Handler(0)
+	clock := cond.Handler(clockWindow)
 	{
 		// Dashboard endpoints
 		dashboard := api.Group("/dashboard")
 		{
-			dashboard.GET("/last_study_session", h.GetLastStudySession)
-			dashboard.GET("/study_progress", h.GetStudyProgress)
-			dashboard.GET("/quick-stats", h.GetQuickStats)
+			dashboard.GET("/last_study_session", data, h.handle((*Handlers).GetLastStudySession))
+			dashboard.GET("/study_progress", data, h.handle((*Handlers).GetStudyProgress))
+			dashboard.GET("/quick-stats", clock, h.handle((*Handlers).GetQuickStats))
+			dashboard.GET("/goals", clock, h.handle((*Handlers).GetGoalHistory))
+			dashboard.GET("/activity", clock, h.handle((*Handlers).GetActivity))
 		}
 
 		// Words endpoints
-		api.GET("/words", h.GetWords)
-		api.GET("/words/:id", h.GetWord)
+		api.GET("/words", data, h.handle(versioned.getWords))
+		api.GET("/words/:id", data, h.handle(versioned.getWord))
+		api.DELETE("/words/:id", h.handle((*Handlers).DeleteWord))
+		api.GET("/words/:id/reviews", data, h.handle((*Handlers).GetWordReviews))
+		api.GET("/words/:id/sentences", data, h.handle((*Handlers).GetWordSentences))
+		api.POST("/words/:id/sentences", h.handle((*Handlers).CreateSentence))
+
+		// Leech endpoints
+		api.GET("/leeches", data, h.handle((*Handlers).GetLeeches))
+
+		// Example sentences endpoints
+		api.GET("/sentences/:id", data, h.handle((*Handlers).GetSentence))
+		api.PUT("/sentences/:id", h.handle((*Handlers).UpdateSentence))
+		api.DELETE("/sentences/:id", h.handle((*Handlers).DeleteSentence))
 
 		// Groups endpoints
-		api.GET("/groups", h.GetGroups)
-		api.GET("/groups/:id", h.GetGroup)
-		api.GET("/groups/:id/words", h.GetGroupWords)
-		api.GET("/groups/:id/study_sessions", h.GetGroupStudySessions)
+		api.GET("/groups", clock, h.handle((*Handlers).GetGroups))
+		api.GET("/groups/:id", clock, h.handle((*Handlers).GetGroup))
+		api.DELETE("/groups/:id", h.handle((*Handlers).DeleteGroup))
+		api.GET("/groups/:id/words", clock, h.handle(versioned.getGroupWords))
+		api.GET("/groups/:id/study_sessions", data, h.handle(versioned.getGroupStudySessions))
+		api.GET("/groups/:id/sentences", clock, h.handle((*Handlers).GetGroupSentences))
+
+		// Smart group endpoints
+		api.POST("/smart_groups", h.handle((*Handlers).CreateSmartGroup))
+		api.PUT("/smart_groups/:id", h.handle((*Handlers).UpdateSmartGroup))
+		api.DELETE("/smart_groups/:id", h.handle((*Handlers).DeleteSmartGroup))
 
 		// Study activities endpoints
-		api.GET("/study_activities/:id", h.GetStudyActivity)
-		api.GET("/study_activities/:id/study_sessions", h.GetStudyActivitySessions)
-		api.POST("/study_activities", h.CreateStudySession)
+		api.GET("/study_activities/:id", data, h.handle((*Handlers).GetStudyActivity))
+		api.DELETE("/study_activities/:id", h.handle((*Handlers).DeleteStudyActivity))
+		api.GET("/study_activities/:id/study_sessions", data, h.handle(versioned.getStudyActivitySessions))
+		api.POST("/study_activities", h.handle((*Handlers).CreateStudySession))
 
 		// Study sessions endpoints
-		api.GET("/study_sessions", h.GetStudySessions)
-		api.GET("/study_sessions/:id", h.GetStudySession)
-		api.GET("/study_sessions/:id/words", h.GetStudySessionWords)
-		api.POST("/study_sessions/:id/words/:word_id/review", h.ReviewWord)
+		api.GET("/study_sessions", data, h.handle(versioned.getStudySessions))
+		api.GET("/study_sessions/:id", data, h.handle(versioned.getStudySession))
+		api.DELETE("/study_sessions/:id", h.handle((*Handlers).DeleteStudySession))
+		api.GET("/study_sessions/:id/words", data, h.handle(versioned.getStudySessionWords))
+		api.GET("/study_sessions/:id/summary", data, h.handle((*Handlers).GetStudySessionSummary))
+		api.POST("/study_sessions/:id/words/:word_id/review", h.handle(versioned.reviewWord))
+		api.GET("/study_sessions/:id/quiz", h.handle((*Handlers).GetQuiz))
+		api.POST("/study_sessions/:id/quiz", h.handle(versioned.gradeQuiz))
+
+		// Tools endpoints
+		api.GET("/tools/transliterate", h.handle((*Handlers).Transliterate))
+
+		// Settings endpoints
+		api.GET("/settings", clock, h.handle((*Handlers).GetSettings))
+		api.PUT("/settings", h.handle((*Handlers).UpdateSettings))
+
+		// Webhook endpoints
+		api.GET("/webhooks", h.handle((*Handlers).GetWebhooks))
+		api.POST("/webhooks", h.handle((*Handlers).CreateWebhook))
+		api.GET("/webhooks/:id", h.handle((*Handlers).GetWebhook))
+		api.PUT("/webhooks/:id", h.handle((*Handlers).UpdateWebhook))
+		api.DELETE("/webhooks/:id", h.handle((*Handlers).DeleteWebhook))
+		api.GET("/webhooks/:id/deliveries", h.handle((*Handlers).GetWebhookDeliveries))
+		api.POST("/webhooks/:id/deliveries/:delivery_id/replay", h.handle((*Handlers).ReplayWebhookDelivery))
+
+		// Data portability. Archives are downloads, so they are not cached.
+		api.GET("/export", h.handle((*Handlers).Export))
+		api.POST("/import", h.handle((*Handlers).Import))
+
+		// Trash endpoints
+		api.GET("/trash", data, h.handle((*Handlers).GetTrash))
+		api.POST("/trash/:type/:id/restore", h.handle((*Handlers).RestoreTrashItem))
+
+		// Live updates
+		api.GET("/events", h.handle((*Handlers).GetEvents))
 
 		// System endpoints
-		api.POST("/reset_history", h.ResetHistory)
-		api.POST("/full_reset", h.FullReset)
+		api.POST("/reset_history", h.handle((*Handlers).ResetHistory))
+		api.POST("/full_reset", h.handle((*Handlers).FullReset))
 	}
 }
 
 // Dashboard handlers
 func (h *Handlers) GetLastStudySession(c *gin.Context) {
-	session, err := h.dashboard.GetLastStudySession()
+	session, err := h.dashboard.GetLastStudySession(c.Query("language"))
 	if err != nil {
 		if err.Error() == "no study sessions found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -88,7 +210,7 @@ func (h *Handlers) GetLastStudySession(c *gin.Context) {
 }
 
 func (h *Handlers) GetStudyProgress(c *gin.Context) {
-	progress, err := h.dashboard.GetStudyProgress()
+	progress, err := h.dashboard.GetStudyProgress(c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -97,7 +219,7 @@ func (h *Handlers) GetStudyProgress(c *gin.Context) {
 }
 
 func (h *Handlers) GetQuickStats(c *gin.Context) {
-	stats, err := h.dashboard.GetQuickStats()
+	stats, err := h.dashboard.GetQuickStats(c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -105,10 +227,43 @@ func (h *Handlers) GetQuickStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+func (h *Handlers) GetGoalHistory(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 366 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 366"})
+		return
+	}
+
+	history, err := h.dashboard.GetGoalHistory(days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (h *Handlers) GetActivity(c *gin.Context) {
+	activity, err := h.dashboard.GetActivity(
+		c.Query("from"),
+		c.Query("to"),
+		c.DefaultQuery("bucket", service.BucketDay),
+		c.Query("language"),
+	)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, activity)
+}
+
 // Words handlers
 func (h *Handlers) GetWords(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	response, err := h.words.GetWords(page)
+	response, err := h.words.GetWords(page, c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -142,7 +297,7 @@ func (h *Handlers) GetGroups(c *gin.Context) {
 		page = 1
 	}
 
-	response, err := h.groups.GetGroups(page)
+	response, err := h.groups.GetGroups(page, c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -212,6 +367,285 @@ func (h *Handlers) GetGroupStudySessions(c *gin.Context) {
 	})
 }
 
+func (h *Handlers) GetGroupSentences(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	match := c.DefaultQuery("match", service.SentenceMatchLinked)
+	if match != service.SentenceMatchLinked && match != service.SentenceMatchContains {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "match must be linked or contains"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	sentences, pagination, err := h.sentences.GetGroupSentences(id, match, page)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":      sentences,
+		"pagination": pagination,
+	})
+}
+
+// Smart group handlers
+type smartGroupRequest struct {
+	Name     string             `json:"name" binding:"required"`
+	Language string             `json:"language"`
+	Rules    []models.GroupRule `json:"rules"`
+}
+
+func smartGroupError(c *gin.Context, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+	case strings.HasPrefix(err.Error(), "invalid"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case strings.Contains(err.Error(), "not a smart group") || strings.Contains(err.Error(), "cannot be deleted"):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *Handlers) CreateSmartGroup(c *gin.Context) {
+	var req smartGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Language == "" {
+		req.Language = models.LanguageJapanese
+	}
+
+	group, err := h.groups.CreateSmartGroup(req.Name, req.Language, req.Rules)
+	if err != nil {
+		smartGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, group)
+}
+
+func (h *Handlers) UpdateSmartGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	var req smartGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.groups.UpdateSmartGroup(id, req.Name, req.Rules)
+	if err != nil {
+		smartGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+func (h *Handlers) DeleteSmartGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	if err := h.groups.DeleteSmartGroup(id); err != nil {
+		smartGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Leech handlers
+func (h *Handlers) GetLeeches(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	leeches, pagination, err := h.leeches.GetLeeches(c.Query("language"), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":      leeches,
+		"pagination": pagination,
+	})
+}
+
+// Example sentences handlers
+type sentenceRequest struct {
+	Sentence    string `json:"sentence" binding:"required"`
+	Reading     string `json:"reading"`
+	Translation string `json:"translation"`
+	Source      string `json:"source"`
+}
+
+func (r sentenceRequest) toModel(wordID int) models.ExampleSentence {
+	return models.ExampleSentence{
+		WordID:      wordID,
+		Sentence:    r.Sentence,
+		Reading:     r.Reading,
+		Translation: r.Translation,
+		Source:      r.Source,
+	}
+}
+
+func (h *Handlers) GetWordSentences(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid word ID"})
+		return
+	}
+
+	sentences, err := h.sentences.GetWordSentences(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "word not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": sentences})
+}
+
+func (h *Handlers) GetWordReviews(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid word ID"})
+		return
+	}
+
+	recent := service.DefaultRecentReviews
+	if value := c.Query("last"); value != "" {
+		if recent, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid number of recent reviews"})
+			return
+		}
+	}
+
+	history, err := h.words.GetWordReviews(id, pageQuery(c), recent)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "word not found"})
+			return
+		}
+		if strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (h *Handlers) CreateSentence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid word ID"})
+		return
+	}
+
+	var req sentenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sentence, err := h.sentences.CreateSentence(req.toModel(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "word not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, sentence)
+}
+
+func (h *Handlers) GetSentence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sentence ID"})
+		return
+	}
+
+	sentence, err := h.sentences.GetSentence(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sentence not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sentence)
+}
+
+func (h *Handlers) UpdateSentence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sentence ID"})
+		return
+	}
+
+	var req sentenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sentence, err := h.sentences.UpdateSentence(id, req.toModel(0))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sentence not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sentence)
+}
+
+func (h *Handlers) DeleteSentence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sentence ID"})
+		return
+	}
+
+	if err := h.sentences.DeleteSentence(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sentence not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 // Study activities handlers
 func (h *Handlers) GetStudyActivity(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -336,7 +770,32 @@ func (h *Handlers) GetStudySessionWords(c *gin.Context) {
 	})
 }
 
+func (h *Handlers) GetStudySessionSummary(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study session ID"})
+		return
+	}
+
+	summary, err := h.studySessions.GetStudySessionSummary(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// ReviewWord records a review. The session token is optional in v1, whose
+// clients predate it.
 func (h *Handlers) ReviewWord(c *gin.Context) {
+	h.reviewWord(c, false)
+}
+
+func (h *Handlers) reviewWord(c *gin.Context, tokenRequired bool) {
 	sessionID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study session ID"})
@@ -352,7 +811,19 @@ func (h *Handlers) ReviewWord(c *gin.Context) {
 	correctStr := c.Query("correct")
 	correct := correctStr == "true"
 
-	if err := h.studySessions.ReviewWord(sessionID, wordID, correct); err != nil {
+	// The response time is optional; activities that do not time answers
+	// leave it out
+	var responseTimeMs int
+	if value := c.Query("response_time_ms"); value != "" {
+		responseTimeMs, err = strconv.Atoi(value)
+		if err != nil || responseTimeMs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid response time"})
+			return
+		}
+	}
+
+	// Unknown sessions and words are reported before the token is checked
+	if err := h.studySessions.CheckReviewTarget(sessionID, wordID); err != nil {
 		if strings.Contains(err.Error(), "does not exist") {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
@@ -360,6 +831,22 @@ func (h *Handlers) ReviewWord(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !h.verifySessionToken(c, sessionID, tokenRequired) {
+		return
+	}
+
+	if err := h.studySessions.ReviewWordTimed(sessionID, wordID, correct, responseTimeMs); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":          true,
@@ -370,6 +857,200 @@ func (h *Handlers) ReviewWord(c *gin.Context) {
 	})
 }
 
+// verifySessionToken checks the token a launched study activity sends with its
+// requests. An invalid token, or a missing one when required, aborts the
+// request with 401.
+func (h *Handlers) verifySessionToken(c *gin.Context, sessionID int, required bool) bool {
+	token := c.GetHeader("X-Session-Token")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		if !required {
+			return true
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session token is required"})
+		return false
+	}
+	if err := h.studySessions.VerifySessionToken(sessionID, token); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// checkStudySession answers 404 and returns false when the study session
+// does not exist
+func (h *Handlers) checkStudySession(c *gin.Context, sessionID int) bool {
+	if err := h.studySessions.CheckStudySession(sessionID); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study session not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (h *Handlers) GetQuiz(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study session ID"})
+		return
+	}
+
+	direction := c.DefaultQuery("direction", service.QuizDirectionJapaneseToEnglish)
+	if err := service.ValidateQuizDirection(direction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(service.DefaultQuizQuestions)))
+	if err != nil || count < 1 || count > service.MaxQuizQuestions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and " + strconv.Itoa(service.MaxQuizQuestions)})
+		return
+	}
+
+	choices, err := strconv.Atoi(c.DefaultQuery("choices", strconv.Itoa(service.DefaultQuizChoices)))
+	if err != nil || choices < 2 || choices > service.MaxQuizChoices {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "choices must be between 2 and " + strconv.Itoa(service.MaxQuizChoices)})
+		return
+	}
+
+	// Without a seed a fresh one is picked and returned so the quiz can be reproduced
+	seed := time.Now().UnixNano()
+	if seedStr := c.Query("seed"); seedStr != "" {
+		if seed, err = strconv.ParseInt(seedStr, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid seed"})
+			return
+		}
+	}
+
+	quiz, err := h.quiz.GetQuiz(id, direction, count, choices, seed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, quiz)
+}
+
+// GradeQuiz grades the answers to a quiz. Like ReviewWord, it takes the
+// session token as optional in v1.
+func (h *Handlers) GradeQuiz(c *gin.Context) {
+	h.gradeQuiz(c, false)
+}
+
+func (h *Handlers) gradeQuiz(c *gin.Context, tokenRequired bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study session ID"})
+		return
+	}
+
+	var req struct {
+		Direction string              `json:"direction"`
+		Answers   []models.QuizAnswer `json:"answers"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.Direction == "" {
+		req.Direction = service.QuizDirectionJapaneseToEnglish
+	}
+	if err := service.ValidateQuizDirection(req.Direction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkStudySession(c, id) || !h.verifySessionToken(c, id, tokenRequired) {
+		return
+	}
+
+	result, err := h.quiz.GradeQuiz(id, req.Direction, req.Answers)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study session not found"})
+			return
+		}
+		if strings.Contains(err.Error(), "does not exist") || strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Tools handlers
+func (h *Handlers) Transliterate(c *gin.Context) {
+	text := c.Query("text")
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+
+	to := c.DefaultQuery("to", "hiragana")
+	var result string
+	switch to {
+	case "hiragana":
+		result = kana.ToHiragana(text)
+	case "katakana":
+		result = kana.ToKatakana(text)
+	case "romaji":
+		result = kana.ToRomaji(kana.ToHiragana(text))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be one of hiragana, katakana or romaji"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"text":       text,
+		"to":         to,
+		"result":     result,
+		"normalized": kana.Normalize(text),
+	})
+}
+
+// Settings handlers
+func (h *Handlers) GetSettings(c *gin.Context) {
+	settings, err := h.settings.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *Handlers) UpdateSettings(c *gin.Context) {
+	var req struct {
+		Timezone        *string                 `json:"timezone"`
+		DailyGoal       *models.DailyGoal       `json:"daily_goal"`
+		LeechThresholds *models.LeechThresholds `json:"leech_thresholds"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	settings, err := h.settings.UpdateSettings(req.Timezone, req.DailyGoal, req.LeechThresholds)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid") || strings.HasPrefix(err.Error(), "goal target") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
 // System handlers
 func (h *Handlers) ResetHistory(c *gin.Context) {
 	if err := h.studySessions.ResetHistory(); err != nil {
@@ -5,28 +5,51 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"lang-portal/internal/middleware"
 	"lang-portal/internal/models"
+	"lang-portal/internal/service"
+	"lang-portal/internal/testdb"
 )
 
-func setupTestRouter() (*gin.Engine, *Handlers) {
+// testTokenSecret signs the session tokens of the test router
+var testTokenSecret = []byte("test-secret")
+
+// setupTestRouter serves the API from a test database behind middlewares
+func setupTestRouter(t *testing.T, middlewares ...gin.HandlerFunc) (*gin.Engine, *models.DB) {
+	t.Helper()
 	gin.SetMode(gin.TestMode)
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middlewares...)
 
-	// Initialize test database
-	db, err := models.NewDB("test.db")
+	db := testdb.New(t)
+	tokens, err := service.NewSessionTokenSigner(testTokenSecret, time.Hour)
 	if err != nil {
-		panic(err)
+		t.Fatalf("Failed to create token signer: %v", err)
 	}
-
-	h := NewHandlers(db)
-	h.RegisterRoutes(r)
-	return r, h
+	studySessions := service.NewStudySessionsService(db, tokens)
+	h := NewHandlers(
+		service.NewDashboardService(db),
+		service.NewWordService(db),
+		service.NewGroupsService(db),
+		service.NewStudyActivitiesService(db, tokens),
+		studySessions,
+		service.NewQuizService(db, studySessions),
+		service.NewSentencesService(db),
+		service.NewSettingsService(db),
+		service.NewLeechService(db),
+		service.NewWebhookService(db),
+		service.NewArchiveService(db),
+		service.NewTrashService(db),
+	)
+	h.RegisterRoutes(r, time.Now().AddDate(1, 0, 0), middleware.NewConditional(db, 0))
+	return r, db
 }
 
 func TestGetWords(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/words", nil)
@@ -52,7 +75,7 @@ func TestGetWords(t *testing.T) {
 }
 
 func TestGetGroups(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/groups", nil)
@@ -76,7 +99,7 @@ func TestGetGroups(t *testing.T) {
 }
 
 func TestGetStudySessions(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/study_sessions", nil)
@@ -100,7 +123,7 @@ func TestGetStudySessions(t *testing.T) {
 }
 
 func TestGetDashboardStats(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	// Test Quick Stats
 	t.Run("QuickStats", func(t *testing.T) {
@@ -133,9 +156,9 @@ func TestGetDashboardStats(t *testing.T) {
 			t.Errorf("Expected status %d; got %d", http.StatusOK, w.Code)
 		}
 
-		var response []struct {
-			Date     string `json:"date"`
-			Progress int    `json:"progress"`
+		var response struct {
+			TotalWordsStudied   int `json:"total_words_studied"`
+			TotalAvailableWords int `json:"total_available_words"`
 		}
 
 		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
@@ -145,7 +168,7 @@ func TestGetDashboardStats(t *testing.T) {
 }
 
 func TestErrorHandling(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	// Test 404 Not Found
 	t.Run("NotFound", func(t *testing.T) {
@@ -171,25 +194,47 @@ func TestErrorHandling(t *testing.T) {
 }
 
 func TestReviewWord(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
-	// Create a study session first
-	// This is a simplified example - in a real test, you'd want to properly set up test data
-	sessionID := 1
-	wordID := 1
-
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", 
-		"/api/study_sessions/1/words/1/review?correct=true", nil)
-	router.ServeHTTP(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d; got %d", http.StatusOK, w.Code)
+	tokens, err := service.NewSessionTokenSigner(testTokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create token signer: %v", err)
+	}
+	token, _ := tokens.Sign(1, 1)
+
+	// v1 keeps working without a token; v2 requires one
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"V1WithoutToken", "/api/study_sessions/1/words/1/review", "", http.StatusOK},
+		{"V1InvalidToken", "/api/v1/study_sessions/1/words/1/review", "invalid", http.StatusUnauthorized},
+		{"V1UnknownSession", "/api/study_sessions/999/words/999/review", "", http.StatusNotFound},
+		{"V2WithoutToken", "/api/v2/study_sessions/1/words/1/review", "", http.StatusUnauthorized},
+		{"V2InvalidToken", "/api/v2/study_sessions/1/words/1/review", "invalid", http.StatusUnauthorized},
+		{"V2ValidToken", "/api/v2/study_sessions/1/words/1/review", token, http.StatusOK},
+		{"V2UnknownSession", "/api/v2/study_sessions/999/words/1/review", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path+"?correct=true", nil)
+			if tt.token != "" {
+				req.Header.Set("X-Session-Token", tt.token)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d; got %d", tt.want, w.Code)
+			}
+		})
 	}
 }
 
 func TestResetHistory(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/reset_history", nil)
@@ -200,25 +245,28 @@ func TestResetHistory(t *testing.T) {
 	}
 }
 
-// Helper function to clean up test database after tests
-func cleanupTestDB() {
-	db, err := models.NewDB("test.db")
-	if err != nil {
-		return
-	}
-	defer db.Close()
+func TestCrossOriginResetRefused(t *testing.T) {
+	cors := middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins: middleware.ParseOrigins("http://localhost:5173"),
+		AllowedMethods: []string{"GET", "POST"},
+	})
+	router, db := setupTestRouter(t, cors)
 
-	// Clean up tables
-	tables := []string{
-		"word_review_items",
-		"study_sessions",
-		"study_activities",
-		"words_groups",
-		"groups",
-		"words",
-	}
+	// A form post from another site needs no preflight
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/reset_history", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
 
-	for _, table := range tables {
-		db.Exec("DELETE FROM " + table)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d; got %d", http.StatusForbidden, w.Code)
+	}
+	var sessions int
+	if err := db.QueryRow("SELECT COUNT(*) FROM study_sessions WHERE deleted_at IS NULL").Scan(&sessions); err != nil {
+		t.Fatalf("Failed to count sessions: %v", err)
 	}
-}
\ No newline at end of file
+	if sessions != 1 {
+		t.Errorf("Expected the study history to be kept; got %d sessions", sessions)
+	}
+}
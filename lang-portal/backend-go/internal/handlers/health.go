@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbmigrate "lang-portal/internal/db"
+	"lang-portal/internal/version"
+)
+
+// errDiskUnsupported is returned where free disk space cannot be read
+var errDiskUnsupported = errors.New("free disk space is not supported on this platform")
+
+// readyTimeout bounds the time the readiness checks may take
+const readyTimeout = 2 * time.Second
+
+// HealthHandler serves the liveness, readiness and version endpoints probed
+// by load balancers and supervisors
+type HealthHandler struct {
+	db             *sql.DB
+	migrator       *dbmigrate.MigrationManager
+	migrationsPath string
+	dataDir        string
+	minFreeBytes   uint64
+}
+
+func NewHealthHandler(db *sql.DB, migrator *dbmigrate.MigrationManager, migrationsPath, dataDir string, minFreeBytes uint64) *HealthHandler {
+	return &HealthHandler{
+		db:             db,
+		migrator:       migrator,
+		migrationsPath: migrationsPath,
+		dataDir:        dataDir,
+		minFreeBytes:   minFreeBytes,
+	}
+}
+
+func (h *HealthHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+	r.GET("/version", h.Version)
+}
+
+// Healthz reports that the process is up. It does not touch the database.
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+type readinessCheck struct {
+	Status    string   `json:"status"`
+	Error     string   `json:"error,omitempty"`
+	Pending   []string `json:"pending,omitempty"`
+	FreeBytes *uint64  `json:"free_bytes,omitempty"`
+}
+
+// Readyz reports whether the server can serve requests. It answers 503 when
+// any check fails.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]readinessCheck{
+		"database":   h.checkDatabase(ctx),
+		"migrations": h.checkMigrations(ctx),
+		"data_dir":   h.checkDataDir(ctx),
+		"disk":       h.checkDisk(),
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, check := range checks {
+		if check.Status == "fail" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+func (h *HealthHandler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
+
+func passed() readinessCheck {
+	return readinessCheck{Status: "ok"}
+}
+
+func failed(err error) readinessCheck {
+	return readinessCheck{Status: "fail", Error: err.Error()}
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) readinessCheck {
+	if err := h.db.PingContext(ctx); err != nil {
+		return failed(err)
+	}
+	var one int
+	if err := h.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return failed(err)
+	}
+	return passed()
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) readinessCheck {
+	migrations, err := h.migrator.LoadMigrations(h.migrationsPath)
+	if err != nil {
+		return failed(err)
+	}
+	pending, err := h.migrator.PendingMigrations(ctx, migrations)
+	if err != nil {
+		return failed(err)
+	}
+	if len(pending) > 0 {
+		check := failed(fmt.Errorf("%d migrations are pending", len(pending)))
+		for _, migration := range pending {
+			check.Pending = append(check.Pending, migration.Name)
+		}
+		return check
+	}
+	return passed()
+}
+
+func (h *HealthHandler) checkDataDir(ctx context.Context) readinessCheck {
+	if err := ctx.Err(); err != nil {
+		return failed(err)
+	}
+	file, err := os.CreateTemp(h.dataDir, ".readyz-*")
+	if err != nil {
+		return failed(err)
+	}
+	name := file.Name()
+	_, err = file.WriteString("ok")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	if err != nil {
+		return failed(err)
+	}
+	return passed()
+}
+
+func (h *HealthHandler) checkDisk() readinessCheck {
+	free, err := freeDiskBytes(h.dataDir)
+	if errors.Is(err, errDiskUnsupported) {
+		return readinessCheck{Status: "skipped", Error: err.Error()}
+	}
+	if err != nil {
+		return failed(err)
+	}
+	check := passed()
+	if free < h.minFreeBytes {
+		check = failed(fmt.Errorf("%d bytes free, below the minimum of %d", free, h.minFreeBytes))
+	}
+	check.FreeBytes = &free
+	return check
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	dbmigrate "lang-portal/internal/db"
+	"lang-portal/internal/testdb"
+)
+
+// readyz serves GET /readyz from a test database with the migrations of
+// migrationsPath and the data directory dataDir
+func readyz(t *testing.T, migrationsPath, dataDir string) (int, map[string]readinessCheck) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := testdb.New(t)
+	r := gin.New()
+	NewHealthHandler(db.DB, dbmigrate.NewMigrationManager(db.DB), migrationsPath, dataDir, 0).RegisterRoutes(r)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	r.ServeHTTP(w, req)
+
+	var response struct {
+		Status string                    `json:"status"`
+		Checks map[string]readinessCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if want := map[int]string{http.StatusOK: "ready", http.StatusServiceUnavailable: "not_ready"}[w.Code]; response.Status != want {
+		t.Errorf("Status %q with code %d; want %q", response.Status, w.Code, want)
+	}
+	return w.Code, response.Checks
+}
+
+func TestReadyz(t *testing.T) {
+	migrationsPath := testdb.MigrationsPath()
+
+	t.Run("Ready", func(t *testing.T) {
+		code, checks := readyz(t, migrationsPath, t.TempDir())
+		if code != http.StatusOK {
+			t.Fatalf("Expected status %d; got %d with %+v", http.StatusOK, code, checks)
+		}
+		for _, name := range []string{"database", "migrations", "data_dir"} {
+			if checks[name].Status != "ok" {
+				t.Errorf("Expected the %s check to pass; got %+v", name, checks[name])
+			}
+		}
+	})
+
+	t.Run("PendingMigration", func(t *testing.T) {
+		dir := t.TempDir()
+		files, err := filepath.Glob(filepath.Join(migrationsPath, "*.sql"))
+		if err != nil {
+			t.Fatalf("Failed to list migrations: %v", err)
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read migration: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), content, 0o644); err != nil {
+				t.Fatalf("Failed to copy migration: %v", err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, "9999_pending.sql"), []byte("SELECT 1"), 0o644); err != nil {
+			t.Fatalf("Failed to write migration: %v", err)
+		}
+
+		code, checks := readyz(t, dir, t.TempDir())
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected status %d; got %d", http.StatusServiceUnavailable, code)
+		}
+		if check := checks["migrations"]; check.Status != "fail" || len(check.Pending) != 1 || check.Pending[0] != "9999_pending.sql" {
+			t.Errorf("Expected 9999_pending.sql to be pending; got %+v", check)
+		}
+	})
+
+	t.Run("UnwritableDataDir", func(t *testing.T) {
+		// A file cannot hold files, even for root
+		dataDir := filepath.Join(t.TempDir(), "words.db")
+		if err := os.WriteFile(dataDir, nil, 0o644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+
+		code, checks := readyz(t, migrationsPath, dataDir)
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected status %d; got %d", http.StatusServiceUnavailable, code)
+		}
+		if check := checks["data_dir"]; check.Status != "fail" || check.Error == "" {
+			t.Errorf("Expected the data_dir check to fail; got %+v", check)
+		}
+	})
+}
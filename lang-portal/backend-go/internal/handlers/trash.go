@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trashError reports a failed delete or restore; notFound names the missing item
+func trashError(c *gin.Context, err error, notFound string) {
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case strings.HasPrefix(err.Error(), "invalid"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case strings.Contains(err.Error(), "cannot be"):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// runWithID runs action with the ID of the path, answering 404 with notFound
+func runWithID(c *gin.Context, action func(int) error, invalid, notFound string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid})
+		return
+	}
+	if err := action(id); err != nil {
+		trashError(c, err, notFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (h *Handlers) DeleteWord(c *gin.Context) {
+	runWithID(c, h.words.DeleteWord, "invalid word ID", "word not found")
+}
+
+func (h *Handlers) DeleteGroup(c *gin.Context) {
+	runWithID(c, h.groups.DeleteGroup, "invalid group ID", "group not found")
+}
+
+func (h *Handlers) DeleteStudySession(c *gin.Context) {
+	runWithID(c, h.studySessions.DeleteStudySession, "invalid study session ID", "study session not found")
+}
+
+func (h *Handlers) DeleteStudyActivity(c *gin.Context) {
+	runWithID(c, h.studyActivities.DeleteStudyActivity, "invalid study activity ID", "study activity not found")
+}
+
+func (h *Handlers) GetTrash(c *gin.Context) {
+	items, pagination, err := h.trash.GetTrash(pageQuery(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":      items,
+		"pagination": pagination,
+	})
+}
+
+func (h *Handlers) RestoreTrashItem(c *gin.Context) {
+	itemType := c.Param("type")
+	runWithID(c, func(id int) error {
+		return h.trash.Restore(itemType, id)
+	}, "invalid ID", strings.ReplaceAll(itemType, "_", " ")+" not found in the trash")
+}
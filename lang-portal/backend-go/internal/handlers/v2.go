@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"lang-portal/internal/models"
+)
+
+// versionedHandlers are the handlers of the endpoints whose responses differ
+// between API versions. All other endpoints are shared.
+type versionedHandlers struct {
+	getWords                 func(*Handlers, *gin.Context)
+	getWord                  func(*Handlers, *gin.Context)
+	getGroupWords            func(*Handlers, *gin.Context)
+	getGroupStudySessions    func(*Handlers, *gin.Context)
+	getStudyActivitySessions func(*Handlers, *gin.Context)
+	getStudySessions         func(*Handlers, *gin.Context)
+	getStudySession          func(*Handlers, *gin.Context)
+	getStudySessionWords     func(*Handlers, *gin.Context)
+	reviewWord               func(*Handlers, *gin.Context)
+	gradeQuiz                func(*Handlers, *gin.Context)
+}
+
+func (h *Handlers) v1Handlers() versionedHandlers {
+	return versionedHandlers{
+		getWords:                 (*Handlers).GetWords,
+		getWord:                  (*Handlers).GetWord,
+		getGroupWords:            (*Handlers).GetGroupWords,
+		getGroupStudySessions:    (*Handlers).GetGroupStudySessions,
+		getStudyActivitySessions: (*Handlers).GetStudyActivitySessions,
+		getStudySessions:         (*Handlers).GetStudySessions,
+		getStudySession:          (*Handlers).GetStudySession,
+		getStudySessionWords:     (*Handlers).GetStudySessionWords,
+		reviewWord:               (*Handlers).ReviewWord,
+		gradeQuiz:                (*Handlers).GradeQuiz,
+	}
+}
+
+func (h *Handlers) v2Handlers() versionedHandlers {
+	return versionedHandlers{
+		getWords:                 (*Handlers).GetWordsV2,
+		getWord:                  (*Handlers).GetWordV2,
+		getGroupWords:            (*Handlers).GetGroupWordsV2,
+		getGroupStudySessions:    (*Handlers).GetGroupStudySessionsV2,
+		getStudyActivitySessions: (*Handlers).GetStudyActivitySessionsV2,
+		getStudySessions:         (*Handlers).GetStudySessionsV2,
+		getStudySession:          (*Handlers).GetStudySessionV2,
+		getStudySessionWords:     (*Handlers).GetStudySessionWordsV2,
+		reviewWord:               (*Handlers).ReviewWordV2,
+		gradeQuiz:                (*Handlers).GradeQuizV2,
+	}
+}
+
+// withoutLegacyFields drops the Japanese-specific word fields, which v2 does not return
+func withoutLegacyFields(words []models.WordWithStats) []models.WordWithStats {
+	for i := range words {
+		words[i].LegacyWordFields = models.LegacyWordFields{}
+	}
+	return words
+}
+
+func pageQuery(c *gin.Context) int {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	return page
+}
+
+func (h *Handlers) GetWordsV2(c *gin.Context) {
+	response, err := h.words.GetWords(pageQuery(c), c.Query("language"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response.Items = withoutLegacyFields(response.Items)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handlers) GetWordV2(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid word ID"})
+		return
+	}
+
+	word, err := h.words.GetWordByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "word not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	word.LegacyWordFields = models.LegacyWordFields{}
+	c.JSON(http.StatusOK, word)
+}
+
+func (h *Handlers) GetGroupWordsV2(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	response, err := h.groups.GetGroupWords(id, pageQuery(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response.Items = withoutLegacyFields(response.Items)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handlers) GetGroupStudySessionsV2(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	if _, err := h.groups.GetGroup(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.listStudySessions(c, id, 0)
+}
+
+func (h *Handlers) GetStudyActivitySessionsV2(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study activity ID"})
+		return
+	}
+
+	if _, err := h.studyActivities.GetStudyActivity(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study activity not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.listStudySessions(c, 0, id)
+}
+
+func (h *Handlers) GetStudySessionsV2(c *gin.Context) {
+	h.listStudySessions(c, 0, 0)
+}
+
+func (h *Handlers) listStudySessions(c *gin.Context, groupID, activityID int) {
+	sessions, pagination, err := h.studySessions.ListStudySessions(groupID, activityID, pageQuery(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":      sessions,
+		"pagination": pagination,
+	})
+}
+
+func (h *Handlers) GetStudySessionV2(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study session ID"})
+		return
+	}
+
+	session, err := h.studySessions.GetStudySessionByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *Handlers) GetStudySessionWordsV2(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid study session ID"})
+		return
+	}
+
+	if _, err := h.studySessions.GetStudySessionByID(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "study session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	words, pagination, err := h.studySessions.GetStudySessionWords(id, pageQuery(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if words == nil {
+		words = make([]models.WordWithStats, 0)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":      withoutLegacyFields(words),
+		"pagination": pagination,
+	})
+}
+
+// ReviewWordV2 records a review like ReviewWord, but requires the session
+// token
+func (h *Handlers) ReviewWordV2(c *gin.Context) {
+	h.reviewWord(c, true)
+}
+
+// GradeQuizV2 grades a quiz like GradeQuiz, but requires the session token
+func (h *Handlers) GradeQuizV2(c *gin.Context) {
+	h.gradeQuiz(c, true)
+}
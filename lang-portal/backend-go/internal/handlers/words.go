@@ -22,7 +22,7 @@ func (h *WordHandler) GetWords(c *gin.Context) {
 		page = 1
 	}
 
-	words, err := h.service.GetWords(page)
+	words, err := h.service.GetWords(page, c.Query("language"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,274 @@
+// Package kana converts between hiragana, katakana and romaji and normalises
+// learner answers so that different spellings of the same reading compare equal.
+package kana
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	katakanaOffset = 'ァ' - 'ぁ'
+	longVowelMark  = 'ー'
+	smallTsu       = 'っ'
+)
+
+// IsHiragana reports whether r is a hiragana character
+func IsHiragana(r rune) bool {
+	return r >= 'ぁ' && r <= 'ゖ'
+}
+
+// IsKatakana reports whether r is a katakana character or the long vowel mark
+func IsKatakana(r rune) bool {
+	return (r >= 'ァ' && r <= 'ヶ') || r == longVowelMark
+}
+
+// IsKana reports whether s is made up only of kana and whitespace
+func IsKana(s string) bool {
+	if strings.TrimSpace(s) == "" {
+		return false
+	}
+	for _, r := range s {
+		if !IsHiragana(r) && !IsKatakana(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// KatakanaToHiragana converts katakana to hiragana. The long vowel mark is kept.
+func KatakanaToHiragana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - katakanaOffset
+		}
+		return r
+	}, s)
+}
+
+// HiraganaToKatakana converts hiragana to katakana
+func HiraganaToKatakana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if IsHiragana(r) {
+			return r + katakanaOffset
+		}
+		return r
+	}, s)
+}
+
+// ToHiragana converts romaji and katakana in s to hiragana. Characters that
+// cannot be converted, such as kanji or punctuation, are kept as they are.
+func ToHiragana(s string) string {
+	s = KatakanaToHiragana(expandMacrons(strings.ToLower(s)))
+
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		// Doubled consonants become a small tsu, "tch" is Hepburn for っち
+		if i+1 < len(runes) && isConsonant(r) && r != 'n' &&
+			(runes[i+1] == r || (r == 't' && runes[i+1] == 'c')) {
+			b.WriteRune(smallTsu)
+			i++
+			continue
+		}
+
+		// A lone n becomes ん unless it starts a syllable. In "nn" followed by
+		// a vowel, as in Hepburn "konnichiwa", the second n starts the next one.
+		if r == 'n' {
+			if i+1 == len(runes) || (!isVowel(runes[i+1]) && runes[i+1] != 'y' && runes[i+1] != 'n' && runes[i+1] != '\'') {
+				b.WriteRune('ん')
+				i++
+				continue
+			}
+			if runes[i+1] == 'n' && i+2 < len(runes) && (isVowel(runes[i+2]) || runes[i+2] == 'y') {
+				b.WriteRune('ん')
+				i++
+				continue
+			}
+		}
+
+		// Hepburn writes ん as m before b, m and p
+		if r == 'm' && i+1 < len(runes) && (runes[i+1] == 'b' || runes[i+1] == 'p' || runes[i+1] == 'm') {
+			b.WriteRune('ん')
+			i++
+			continue
+		}
+
+		matched := false
+		for length := 4; length > 0; length-- {
+			if i+length > len(runes) {
+				continue
+			}
+			if kana, ok := romajiToHiragana[string(runes[i:i+length])]; ok {
+				b.WriteString(kana)
+				i += length
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// ToKatakana converts romaji and hiragana in s to katakana
+func ToKatakana(s string) string {
+	return HiraganaToKatakana(ToHiragana(s))
+}
+
+// ToRomaji converts hiragana and katakana in s to Hepburn romaji. The long
+// vowel mark repeats the preceding vowel and a small tsu doubles the
+// following consonant.
+func ToRomaji(s string) string {
+	runes := []rune(KatakanaToHiragana(s))
+
+	var b strings.Builder
+	doubleNext := false
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		if r == smallTsu {
+			doubleNext = true
+			i++
+			continue
+		}
+		if r == longVowelMark {
+			out := b.String()
+			if len(out) > 0 && isVowel(rune(out[len(out)-1])) {
+				b.WriteByte(out[len(out)-1])
+			}
+			i++
+			continue
+		}
+
+		romaji := ""
+		if i+1 < len(runes) {
+			romaji = hiraganaToRomaji[string(runes[i:i+2])]
+		}
+		if romaji != "" {
+			i += 2
+		} else if single, ok := hiraganaToRomaji[string(r)]; ok {
+			romaji = single
+			i++
+		} else {
+			if doubleNext {
+				b.WriteRune(smallTsu)
+				doubleNext = false
+			}
+			b.WriteRune(r)
+			i++
+			continue
+		}
+
+		if doubleNext {
+			if strings.HasPrefix(romaji, "ch") {
+				b.WriteByte('t')
+			} else if isConsonant(rune(romaji[0])) {
+				b.WriteByte(romaji[0])
+			}
+			doubleNext = false
+		}
+
+		// ん before a vowel or y is written n' to keep the reading unambiguous
+		if r == 'ん' && i < len(runes) {
+			if next, ok := hiraganaToRomaji[string(runes[i])]; ok && (isVowel(rune(next[0])) || next[0] == 'y') {
+				romaji = "n'"
+			}
+		}
+
+		b.WriteString(romaji)
+	}
+	if doubleNext {
+		b.WriteRune(smallTsu)
+	}
+	return b.String()
+}
+
+// Normalize returns a comparison key for a Japanese reading written in kana,
+// Hepburn or Kunrei romaji. Case, spacing, long vowels, the small tsu
+// spelling, the n/m before labials and the particles at the end of words are
+// all folded so that "konnichiwa", "konnitiwa", "こんにちは" and "コンニチワ"
+// share the same key.
+func Normalize(s string) string {
+	romaji := FoldParticles(ToRomaji(ToHiragana(strings.TrimSpace(s))))
+
+	var b strings.Builder
+	for _, r := range romaji {
+		if unicode.IsSpace(r) || r == '\'' || r == '-' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	key := b.String()
+
+	for _, long := range []struct{ from, to string }{
+		{"ou", "o"}, {"oo", "o"}, {"uu", "u"}, {"aa", "a"}, {"ii", "i"}, {"ee", "e"},
+	} {
+		key = strings.ReplaceAll(key, long.from, long.to)
+	}
+	return key
+}
+
+// particleSounds are the romaji of the particles は, へ and を as they are
+// written and as they are read
+var particleSounds = []struct{ written, read string }{
+	{"ha", "wa"}, {"he", "e"}, {"wo", "o"},
+}
+
+// FoldParticles rewrites the particles は, へ and を of a romaji reading as
+// they are read, e.g. "konnichiha" to "konnichiwa". A particle is taken to
+// end a longer word or to stand alone between the words of a phrase, so a
+// single は stays "ha"; words that merely end in は, like はは, are read as
+// if it were a particle.
+func FoldParticles(romaji string) string {
+	words := strings.Fields(romaji)
+	for i, word := range words {
+		for _, particle := range particleSounds {
+			if strings.HasSuffix(word, particle.written) && (len(word) > len(particle.written) || len(words) > 1) {
+				words[i] = strings.TrimSuffix(word, particle.written) + particle.read
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Equal reports whether two readings normalise to the same key
+func Equal(a, b string) bool {
+	na, nb := Normalize(a), Normalize(b)
+	return na != "" && na == nb
+}
+
+// ReadingMatches reports whether romaji is a plausible reading of a kana
+// string. It is more lenient than Equal: the particles は, へ and を may be
+// written by sound (wa, e, o) or by kana (ha, he, wo) anywhere, not only at
+// the end of words.
+func ReadingMatches(kanaText, romaji string) bool {
+	particles := strings.NewReplacer("ha", "wa", "he", "e", "wo", "o")
+	return particles.Replace(Normalize(kanaText)) == particles.Replace(Normalize(romaji))
+}
+
+func expandMacrons(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if expanded, ok := macrons[r]; ok {
+			b.WriteString(expanded)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aiueo", r)
+}
+
+func isConsonant(r rune) bool {
+	return r >= 'a' && r <= 'z' && !isVowel(r)
+}
@@ -0,0 +1,90 @@
+package kana
+
+import "testing"
+
+func TestToHiragana(t *testing.T) {
+	tests := map[string]string{
+		"konnichiwa": "こんにちわ",
+		"konnitiwa":  "こんにちわ",
+		"コンニチハ":      "こんにちは",
+		"kitte":      "きって",
+		"matcha":     "まっちゃ",
+		"shimbun":    "しんぶん",
+		"sayōnara":   "さようなら",
+		"kon'ya":     "こんや",
+		"ra-men":     "らーめん",
+		"犬":          "犬",
+	}
+	for input, want := range tests {
+		if got := ToHiragana(input); got != want {
+			t.Errorf("ToHiragana(%q) = %q; want %q", input, got, want)
+		}
+	}
+}
+
+func TestToKatakana(t *testing.T) {
+	if got := ToKatakana("ra-men"); got != "ラーメン" {
+		t.Errorf("ToKatakana(%q) = %q; want %q", "ra-men", got, "ラーメン")
+	}
+}
+
+func TestToRomaji(t *testing.T) {
+	tests := map[string]string{
+		"こんにちは": "konnichiha",
+		"がっこう":  "gakkou",
+		"まっちゃ":  "matcha",
+		"こんや":   "kon'ya",
+		"ラーメン":  "raamen",
+		"しゃしん":  "shashin",
+	}
+	for input, want := range tests {
+		if got := ToRomaji(input); got != want {
+			t.Errorf("ToRomaji(%q) = %q; want %q", input, got, want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	equal := [][2]string{
+		{"konnichiwa", "コンニチワ"},
+		{"konnichiwa", "こんにちは"},
+		{"konnitiwa", "コンニチハ"},
+		{"konnitiwa", "konnichiwa"},
+		{"watashi wa", "わたし は"},
+		{"Tōkyō", "とうきょう"},
+		{"tokyo", "toukyou"},
+		{"gakkou", "がっこう"},
+		{"shimbun", "shinbun"},
+	}
+	for _, pair := range equal {
+		if !Equal(pair[0], pair[1]) {
+			t.Errorf("Expected %q and %q to be equal (%q, %q)", pair[0], pair[1], Normalize(pair[0]), Normalize(pair[1]))
+		}
+	}
+
+	differ := [][2]string{
+		{"neko", "inu"},
+		{"hana", "わな"},
+		{"は", "wa"},
+	}
+	for _, pair := range differ {
+		if Equal(pair[0], pair[1]) {
+			t.Errorf("Expected %q and %q to differ", pair[0], pair[1])
+		}
+	}
+	if Equal("", "") {
+		t.Errorf("Expected empty answers not to match")
+	}
+}
+
+func TestReadingMatches(t *testing.T) {
+	if !ReadingMatches("こんにちは", "konnichiwa") {
+		t.Errorf("Expected particle は to match wa")
+	}
+	if !ReadingMatches("さようなら", "sayounara") {
+		t.Errorf("Expected matching reading")
+	}
+	if ReadingMatches("さようなら", "konnichiwa") {
+		t.Errorf("Expected mismatching reading")
+	}
+}
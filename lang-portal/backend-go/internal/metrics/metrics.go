@@ -0,0 +1,119 @@
+// Package metrics defines the Prometheus metrics of the server and the
+// registry they are scraped from at /metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "langportal"
+
+// Registry holds every metric of the server
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "SQLite query latency by the service method that ran the query.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1},
+	}, []string{"method"})
+
+	DBQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Failed SQLite queries by the service method that ran the query.",
+	}, []string{"method"})
+
+	ReviewsRecorded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reviews_recorded_total",
+		Help:      "Word reviews recorded, by whether the answer was correct.",
+	}, []string{"correct"})
+
+	SessionsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "study_sessions_created_total",
+		Help:      "Study sessions started.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		DBQueryDuration,
+		DBQueryErrors,
+		ReviewsRecorded,
+		SessionsCreated,
+	)
+}
+
+// RegisterDB adds the connection pool stats of db and the overall review
+// accuracy, which is read from the database on every scrape
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(db, "sqlite"),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "review_accuracy_ratio",
+			Help:      "Share of the live reviews, neither deleted nor archived, that were correct.",
+		}, func() float64 {
+			// Archived reviews are deleted too, so deleted_at covers both
+			var accuracy sql.NullFloat64
+			if err := db.QueryRow("SELECT AVG(correct) FROM word_review_items WHERE deleted_at IS NULL").Scan(&accuracy); err != nil {
+				return 0
+			}
+			return accuracy.Float64
+		}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RecordReview counts a recorded review
+func RecordReview(correct bool) {
+	if correct {
+		ReviewsRecorded.WithLabelValues("true").Inc()
+	} else {
+		ReviewsRecorded.WithLabelValues("false").Inc()
+	}
+}
+
+// ObserveQuery records the duration of a query under the label of its
+// database, the service method that ran it, or "other" when it has none. It
+// is a models.QueryObserver.
+func ObserveQuery(ctx context.Context, label, query string, start time.Time, err error) {
+	if label == "" {
+		label = "other"
+	}
+	DBQueryDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DBQueryErrors.WithLabelValues(label).Inc()
+	}
+}
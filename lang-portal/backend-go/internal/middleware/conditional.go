@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DataVersioner reports the version of the data behind read responses
+type DataVersioner interface {
+	// DataVersion returns a counter that grows with every write and the
+	// time of the last write
+	DataVersion() (uint64, time.Time)
+}
+
+// Conditional answers GET requests from the data version without running
+// their handlers when the client's copy is still current, and optionally
+// from a response cache that writes invalidate.
+type Conditional struct {
+	versions DataVersioner
+	// epoch tells versions of different server runs apart, as the counter
+	// starts over with every run
+	epoch string
+	cache *responseCache
+	now   func() time.Time
+}
+
+// NewConditional tags responses with the version of versions. cacheEntries
+// bounds the response cache; 0 disables it.
+func NewConditional(versions DataVersioner, cacheEntries int) *Conditional {
+	cond := &Conditional{versions: versions, epoch: newRequestID()[:8], now: time.Now}
+	if cacheEntries > 0 {
+		cond.cache = newResponseCache(cacheEntries)
+	}
+	return cond
+}
+
+// Handler returns middleware for a GET route whose 200 responses only depend
+// on the data. Routes that also depend on the clock, e.g. on the current
+// day, pass the window after which their responses are recomputed anyway;
+// routes that only depend on the data pass 0.
+//
+// Responses carry an ETag and a Last-Modified header. Requests whose
+// If-None-Match, or else If-Modified-Since, still matches get 304.
+func (cond *Conditional) Handler(window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		now := cond.now()
+		version, modified := cond.versions.DataVersion()
+		tag := fmt.Sprintf("%s-%d", cond.epoch, version)
+		if window > 0 {
+			windowStart := now.Truncate(window)
+			tag = fmt.Sprintf("%s-%d", tag, windowStart.Unix())
+			if windowStart.After(modified) {
+				modified = windowStart
+			}
+		}
+		etag := `W/"` + tag + `"`
+
+		header := c.Writer.Header()
+		header.Set("ETag", etag)
+		// Last-Modified has whole seconds, so it cannot tell a response from
+		// one after a write in the same second. It is left out until the
+		// second is over and clients fall back on the ETag.
+		if modified.Truncate(time.Second).Before(now.Truncate(time.Second)) {
+			header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+
+		if notModified(c.Request, etag, modified, now) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+
+		key := c.Request.URL.RequestURI()
+		if cond.cache != nil {
+			if entry, ok := cond.cache.get(key, tag); ok {
+				c.Data(http.StatusOK, entry.contentType, entry.body)
+				c.Abort()
+				return
+			}
+		}
+
+		writer := &conditionalWriter{ResponseWriter: c.Writer, capture: cond.cache != nil}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.capture && writer.Status() == http.StatusOK {
+			cond.cache.put(key, cachedResponse{
+				version:     version,
+				tag:         tag,
+				contentType: writer.Header().Get("Content-Type"),
+				body:        writer.body.Bytes(),
+			})
+		}
+	}
+}
+
+// notModified tells whether the client's copy of a response is current.
+// If-None-Match takes precedence over If-Modified-Since.
+func notModified(req *http.Request, etag string, modified, now time.Time) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified = modified.Truncate(time.Second)
+	return !modified.After(since) && modified.Before(now.Truncate(time.Second))
+}
+
+// conditionalWriter drops the validators from responses other than 200, as
+// error responses must not be revalidated, and keeps the body for the cache
+type conditionalWriter struct {
+	gin.ResponseWriter
+	capture bool
+	body    bytes.Buffer
+}
+
+func (w *conditionalWriter) WriteHeader(code int) {
+	if code != http.StatusOK {
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		w.capture = false
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *conditionalWriter) Write(data []byte) (int, error) {
+	if w.capture {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *conditionalWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+type cachedResponse struct {
+	version     uint64
+	tag         string
+	contentType string
+	body        []byte
+}
+
+// responseCache keeps the most recently used responses. Entries of older
+// versions are never served; the first response of a newer version empties
+// the cache.
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	version uint64
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheItem struct {
+	key      string
+	response cachedResponse
+}
+
+func newResponseCache(size int) *responseCache {
+	return &responseCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (rc *responseCache) get(key, tag string) (cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	element, ok := rc.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	item := element.Value.(*cacheItem)
+	if item.response.tag != tag {
+		rc.order.Remove(element)
+		delete(rc.entries, key)
+		return cachedResponse{}, false
+	}
+	rc.order.MoveToFront(element)
+	return item.response, true
+}
+
+func (rc *responseCache) put(key string, response cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	switch {
+	case response.version < rc.version:
+		// The data changed while the response was made
+		return
+	case response.version > rc.version:
+		rc.version = response.version
+		rc.entries = make(map[string]*list.Element)
+		rc.order.Init()
+	}
+	if element, ok := rc.entries[key]; ok {
+		element.Value.(*cacheItem).response = response
+		rc.order.MoveToFront(element)
+		return
+	}
+	rc.entries[key] = rc.order.PushFront(&cacheItem{key: key, response: response})
+	for rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheItem).key)
+	}
+}
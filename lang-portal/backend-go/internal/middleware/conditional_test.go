@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeVersions struct {
+	version  uint64
+	modified time.Time
+}
+
+func (v *fakeVersions) DataVersion() (uint64, time.Time) {
+	return v.version, v.modified
+}
+
+func TestConditional(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2026, 3, 1, 12, 0, 30, 0, time.UTC)
+	versions := &fakeVersions{modified: now.Add(-time.Hour)}
+	cond := NewConditional(versions, 10)
+	cond.now = func() time.Time { return now }
+
+	calls := 0
+	r := gin.New()
+	r.GET("/api/groups", cond.Handler(0), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+	r.GET("/api/groups/:id", cond.Handler(0), func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+	})
+	r.GET("/api/dashboard/quick-stats", cond.Handler(time.Minute), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("/api/groups", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag; got %d %q", first.Code, etag)
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Sun, 01 Mar 2026 11:00:30 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	// A current copy is answered without running the handler
+	w := get("/api/groups", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified || calls != 1 {
+		t.Errorf("Expected 304 without a call; got %d after %d calls", w.Code, calls)
+	}
+	w = get("/api/groups", http.Header{"If-Modified-Since": {first.Header().Get("Last-Modified")}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for If-Modified-Since; got %d", w.Code)
+	}
+
+	// Without validators the response comes from the cache
+	w = get("/api/groups", nil)
+	if w.Code != http.StatusOK || w.Body.String() != first.Body.String() || calls != 1 {
+		t.Errorf("Expected the cached response; got %d %s after %d calls", w.Code, w.Body.String(), calls)
+	}
+
+	// A write invalidates both the client's copy and the cache
+	versions.version, versions.modified = 1, now.Add(-time.Minute)
+	w = get("/api/groups", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusOK || calls != 2 || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected a fresh response after a write; got %d after %d calls", w.Code, calls)
+	}
+
+	// Errors carry no validators
+	w = get("/api/groups/7", nil)
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" || w.Header().Get("Last-Modified") != "" {
+		t.Errorf("Expected a 404 without validators; got %d %v", w.Code, w.Header())
+	}
+
+	// Clock dependent responses change with the window
+	w = get("/api/dashboard/quick-stats", nil)
+	windowTag := w.Header().Get("ETag")
+	if got := w.Header().Get("Last-Modified"); got != "Sun, 01 Mar 2026 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q; want the window start", got)
+	}
+	now = now.Add(time.Minute)
+	w = get("/api/dashboard/quick-stats", http.Header{"If-None-Match": {windowTag}})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 in a new window; got %d", w.Code)
+	}
+
+	// Last-Modified is held back in the second of a write
+	versions.version, versions.modified = 2, now
+	w = get("/api/groups", nil)
+	if got := w.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("Last-Modified = %q; want none in the second of a write", got)
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig sets which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins are origins such as "https://portal.example.com".
+	// "https://*.example.com" allows every subdomain of example.com, and "*"
+	// allows every origin, though never with credentials.
+	AllowedOrigins []string
+	// AllowCredentials lets allowed origins send cookies and Authorization
+	AllowCredentials bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// ParseOrigins reads a comma separated origin allowlist
+func ParseOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+type originPattern struct {
+	scheme string
+	// suffix is set for wildcard patterns and holds ".example.com"
+	suffix string
+	origin string
+}
+
+func (p originPattern) matches(origin string) bool {
+	if p.suffix == "" {
+		return origin == p.origin
+	}
+	host, ok := strings.CutPrefix(origin, p.scheme+"://")
+	return ok && strings.HasSuffix(host, p.suffix) && len(host) > len(p.suffix)
+}
+
+// CORS answers preflight requests and adds CORS headers to the responses to
+// allowed origins. Reads from other origins are served without them, so
+// browsers do not let the calling page read the response. Their preflight
+// requests and writes get 403, as simple and no-cors writes like the resets
+// need no preflight and would otherwise run.
+func CORS(config CORSConfig) gin.HandlerFunc {
+	anyOrigin := false
+	var patterns []originPattern
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			anyOrigin = true
+			continue
+		}
+		scheme, host, _ := strings.Cut(origin, "://")
+		if suffix, ok := strings.CutPrefix(host, "*"); ok {
+			patterns = append(patterns, originPattern{scheme: scheme, suffix: suffix})
+		} else {
+			patterns = append(patterns, originPattern{origin: origin})
+		}
+	}
+	allowed := func(origin string) bool {
+		origin = strings.ToLower(origin)
+		for _, p := range patterns {
+			if p.matches(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		switch {
+		case allowed(origin):
+			header.Set("Access-Control-Allow-Origin", origin)
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		case anyOrigin:
+			header.Set("Access-Control-Allow-Origin", "*")
+		default:
+			if preflight || !safeMethod(c.Request.Method) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !preflight {
+			if exposed != "" {
+				header.Set("Access-Control-Expose-Headers", exposed)
+			}
+			c.Next()
+			return
+		}
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", methods)
+		if headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		if config.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// safeMethod reports whether requests with method only read
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORS(CORSConfig{
+		AllowedOrigins:   ParseOrigins("http://localhost:5173, https://*.example.com/"),
+		AllowCredentials: true,
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "X-User-ID"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		MaxAge:           10 * time.Minute,
+	}))
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	r.GET("/api/full_reset", handler)
+	r.POST("/api/full_reset", handler)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantAllowed string
+	}{
+		{"exact origin", http.MethodPost, "http://localhost:5173", false, http.StatusOK, "http://localhost:5173"},
+		{"subdomain", http.MethodPost, "https://app.example.com", false, http.StatusOK, "https://app.example.com"},
+		{"nested subdomain", http.MethodPost, "https://a.b.example.com", false, http.StatusOK, "https://a.b.example.com"},
+		{"bare wildcard domain", http.MethodPost, "https://example.com", false, http.StatusForbidden, ""},
+		{"wildcard wrong scheme", http.MethodPost, "http://app.example.com", false, http.StatusForbidden, ""},
+		{"lookalike domain", http.MethodPost, "https://evilexample.com", false, http.StatusForbidden, ""},
+		{"other port", http.MethodPost, "http://localhost:3000", false, http.StatusForbidden, ""},
+		{"refused origin read", http.MethodGet, "https://evil.test", false, http.StatusOK, ""},
+		{"no origin", http.MethodPost, "", false, http.StatusOK, ""},
+		{"allowed preflight", http.MethodOptions, "https://app.example.com", true, http.StatusNoContent, "https://app.example.com"},
+		{"refused preflight", http.MethodOptions, "https://evil.test", true, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/full_reset", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin = %q; want %q", got, tt.wantAllowed)
+			}
+			if tt.wantAllowed == "" {
+				return
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials = %q; want true", got)
+			}
+			if tt.preflight {
+				if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+					t.Errorf("Access-Control-Max-Age = %q; want 600", got)
+				}
+				if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-User-ID" {
+					t.Errorf("Access-Control-Allow-Headers = %q", got)
+				}
+			} else if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID" {
+				t.Errorf("Access-Control-Expose-Headers = %q", got)
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORS(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	r.GET("/api/words", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/words", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q; want *", got)
+	}
+	// Browsers reject credentials with a wildcard origin
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q; want none", got)
+	}
+}
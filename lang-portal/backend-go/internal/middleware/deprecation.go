@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation marks every response of a deprecated API version. It sets the
+// Deprecation and Sunset headers and links to the same path under
+// successorPrefix, which replaces prefix in the request path.
+func Deprecation(sunset time.Time, prefix, successorPrefix string) gin.HandlerFunc {
+	sunsetHeader := sunset.UTC().Format(http.TimeFormat)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Sunset", sunsetHeader)
+		if successor, ok := strings.CutPrefix(c.Request.URL.Path, prefix); ok {
+			c.Header("Link", "<"+successorPrefix+successor+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
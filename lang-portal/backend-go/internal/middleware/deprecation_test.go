@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeprecation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	r.Group("/api/v1", Deprecation(sunset, "/api/v1", "/api/v2")).GET("/words", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/words", nil))
+
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation header = %q; want true", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+		t.Errorf("Sunset header = %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `</api/v2/words>; rel="successor-version"` {
+		t.Errorf("Link header = %q", got)
+	}
+}
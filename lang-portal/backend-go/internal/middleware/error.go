@@ -3,16 +3,17 @@ package middleware
 import (
 	"database/sql"
 	"errors"
-	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"lang-portal/internal/logging"
 )
 
 // ErrorResponse represents a standardized error response
 type ErrorResponse struct {
-	Error string `json:"error"`
-	Code  int    `json:"code"`
+	Error     string `json:"error"`
+	Code      int    `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // ErrorHandler middleware handles errors in a consistent way
@@ -20,8 +21,9 @@ func ErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
 
-		// Only handle errors if we have any
-		if len(c.Errors) == 0 {
+		// Only handle errors if we have any and the handler has not
+		// answered already, as it does after a failed BindJSON
+		if len(c.Errors) == 0 || c.Writer.Written() {
 			return
 		}
 
@@ -40,12 +42,13 @@ func ErrorHandler() gin.HandlerFunc {
 			statusCode = http.StatusInternalServerError
 			message = "Internal server error"
 			// Log the actual error for debugging
-			log.Printf("Internal error: %v", err)
+			logging.FromContext(c.Request.Context()).Error("internal error", "error", err)
 		}
 
 		c.JSON(statusCode, ErrorResponse{
-			Error: message,
-			Code:  statusCode,
+			Error:     message,
+			Code:      statusCode,
+			RequestID: c.GetString(RequestIDKey),
 		})
 	}
 }
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"lang-portal/internal/logging"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request in and out
+	RequestIDHeader = "X-Request-ID"
+	// UserHeader identifies the learner making a request. The portal has no
+	// accounts, so clients choose the value.
+	UserHeader = "X-User-ID"
+
+	// RequestIDKey is the gin context key of the request ID
+	RequestIDKey = "request_id"
+	// errorKey is the gin context key of the message of an error response
+	errorKey = "error"
+	// loggerKey is the gin context key of the request logger. Middleware that
+	// runs before RequestID cannot rely on the request context, which inner
+	// middleware may restore on the way out.
+	loggerKey = "logger"
+)
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// User returns the learner of a request, or an empty string
+func User(c *gin.Context) string {
+	user := strings.TrimSpace(c.GetHeader(UserHeader))
+	if len(user) > 64 {
+		user = user[:64]
+	}
+	return user
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID gives every request an ID, taken from X-Request-ID when the
+// client sent a valid one. The ID is echoed in the X-Request-ID response
+// header and in the body of JSON error responses, and the request context
+// carries a logger that adds it, and the trace ID if the request is traced,
+// to every log line.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+		c.Set(loggerKey, logger)
+		c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), logger))
+
+		writer := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.buffered {
+			body := writer.body.Bytes()
+			var payload map[string]interface{}
+			if err := json.Unmarshal(body, &payload); err == nil {
+				if message, ok := payload["error"].(string); ok {
+					c.Set(errorKey, message)
+				}
+				payload["request_id"] = id
+				if encoded, err := json.Marshal(payload); err == nil {
+					body = encoded
+				}
+			}
+			c.Writer.Write(body)
+		}
+	}
+}
+
+// errorBodyWriter holds back JSON error bodies so the request ID can be added
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	buffered bool
+}
+
+func (w *errorBodyWriter) holdBack() bool {
+	return w.ResponseWriter.Status() >= http.StatusBadRequest &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.holdBack() {
+		w.buffered = true
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *errorBodyWriter) Written() bool {
+	return w.buffered || w.ResponseWriter.Written()
+}
+
+// Logger writes one structured log line per request with its route, status,
+// latency and user. Register it before RequestID so the line carries the ID.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if user := User(c); user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+		if message := c.GetString(errorKey); message != "" {
+			attrs = append(attrs, slog.String("error", message))
+		}
+		logger, ok := c.Value(loggerKey).(*slog.Logger)
+		if !ok {
+			logger = slog.Default()
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 response and logs it with the request ID
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err interface{}) {
+		logging.FromContext(c.Request.Context()).Error("panic", "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	})
+}
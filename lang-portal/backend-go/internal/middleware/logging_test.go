@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"lang-portal/internal/logging"
+)
+
+func TestRequestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	r := gin.New()
+	r.Use(Logger(), RequestID())
+	r.GET("/words/:id", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("looking up word")
+		c.JSON(http.StatusNotFound, gin.H{"error": "word not found"})
+	})
+	r.GET("/words", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"items": []string{}})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/words/7", nil)
+	req.Header.Set(RequestIDHeader, "trace-42")
+	req.Header.Set(UserHeader, "alice")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "trace-42" {
+		t.Errorf("X-Request-ID = %q; want trace-42", got)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode body %q: %v", w.Body.String(), err)
+	}
+	if body["request_id"] != "trace-42" || body["error"] != "word not found" {
+		t.Errorf("Expected the request ID in the error body; got %v", body)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines; got %q", logs.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil || entry["request_id"] != "trace-42" {
+		t.Errorf("Expected handler log to carry the request ID; got %s", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("Failed to decode log line %q: %v", lines[1], err)
+	}
+	if entry["route"] != "/words/:id" || entry["status"] != float64(404) || entry["user"] != "alice" ||
+		entry["request_id"] != "trace-42" || entry["error"] != "word not found" {
+		t.Errorf("Unexpected request log: %v", entry)
+	}
+
+	// Successful responses are left alone and invalid IDs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/words", nil)
+	req.Header.Set(RequestIDHeader, "not a valid id")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != `{"items":[]}` {
+		t.Errorf("Expected an unchanged body; got %s", w.Body.String())
+	}
+	if got := w.Header().Get(RequestIDHeader); len(got) != 32 {
+		t.Errorf("Expected a generated request ID; got %q", got)
+	}
+}
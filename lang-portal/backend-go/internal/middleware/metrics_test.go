@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"lang-portal/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics())
+	r.GET("/words/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	found := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/words/:id", "200")
+	unmatched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+	beforeFound, beforeUnmatched := testutil.ToFloat64(found), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/words/1", "/words/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(found) - beforeFound; got != 2 {
+		t.Errorf("Expected 2 requests counted for the route; got %v", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - beforeUnmatched; got != 1 {
+		t.Errorf("Expected 1 unmatched request; got %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the metrics to be served; got %d", w.Code)
+	}
+}
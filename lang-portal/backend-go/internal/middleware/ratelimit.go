@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate requests
+// per second. The zero Limit does not limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// ParseLimit reads a limit written as "RATE,BURST", e.g. "5,20" for 5
+// requests per second with bursts of 20. "off" disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	if strings.TrimSpace(value) == "off" {
+		return Limit{}, nil
+	}
+	rate, burst, ok := strings.Cut(value, ",")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: want RATE,BURST", value)
+	}
+	var l Limit
+	var err error
+	if l.Rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || l.Rate <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: rate must be a positive number", value)
+	}
+	if l.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || l.Burst < 1 {
+		return Limit{}, fmt.Errorf("invalid limit %q: burst must be a positive integer", value)
+	}
+	return l, nil
+}
+
+// RouteLimits are the limits of the three classes of API routes
+type RouteLimits struct {
+	// Read applies to GET, HEAD and OPTIONS requests
+	Read Limit
+	// Write applies to the other methods
+	Write Limit
+	// Reset applies to the routes that erase or bulk import data
+	Reset Limit
+}
+
+func (l RouteLimits) forClass(class string) Limit {
+	switch class {
+	case classReset:
+		return l.Reset
+	case classWrite:
+		return l.Write
+	default:
+		return l.Read
+	}
+}
+
+// RateLimitConfig sets the limits per client IP and per user. A request has
+// to pass both; requests without a user only count against their IP.
+type RateLimitConfig struct {
+	PerIP   RouteLimits
+	PerUser RouteLimits
+}
+
+const (
+	classRead  = "read"
+	classWrite = "write"
+	classReset = "reset"
+)
+
+// routeClass sorts API routes into read, write and reset routes
+func routeClass(c *gin.Context) string {
+	route := c.FullPath()
+	if strings.HasSuffix(route, "/reset_history") || strings.HasSuffix(route, "/full_reset") || strings.HasSuffix(route, "/import") {
+		return classReset
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return classRead
+	}
+	return classWrite
+}
+
+// bucketSweepInterval is how often buckets that have refilled are dropped
+const bucketSweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+type limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func newLimiter(now func() time.Time) *limiter {
+	return &limiter{buckets: make(map[string]*bucket), now: now, lastSweep: now()}
+}
+
+// take removes a token from the bucket of key. It returns whether there was
+// one, the tokens left and how long until the next token.
+func (l *limiter) take(key string, limit Limit) (bool, float64, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= bucketSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+		return false, b.tokens, wait
+	}
+	b.tokens--
+	return true, b.tokens, 0
+}
+
+// sweep drops buckets that have refilled, which behave like new ones
+func (l *limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// RateLimit throttles API routes with token buckets per client IP and per
+// user. Every response reports the most constrained bucket in the
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers;
+// throttled requests get 429 with Retry-After. Routes outside /api, such as
+// the health probes, are not limited.
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	return rateLimit(config, newLimiter(time.Now))
+}
+
+func rateLimit(config RateLimitConfig, l *limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.FullPath(), "/api") {
+			c.Next()
+			return
+		}
+
+		class := routeClass(c)
+		type check struct {
+			key   string
+			limit Limit
+		}
+		checks := []check{{key: class + "|ip:" + c.ClientIP(), limit: config.PerIP.forClass(class)}}
+		if user := User(c); user != "" {
+			checks = append(checks, check{key: class + "|user:" + user, limit: config.PerUser.forClass(class)})
+		}
+
+		var tightest Limit
+		remaining := math.Inf(1)
+		for _, check := range checks {
+			if !check.limit.enabled() {
+				continue
+			}
+			ok, left, wait := l.take(check.key, check.limit)
+			if !ok {
+				setLimitHeaders(c, check.limit, left)
+				c.Header("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+				return
+			}
+			if left < remaining {
+				tightest, remaining = check.limit, left
+			}
+		}
+		if tightest.enabled() {
+			setLimitHeaders(c, tightest, remaining)
+		}
+		c.Next()
+	}
+}
+
+// setLimitHeaders reports a bucket: its size, the whole tokens left and the
+// seconds until it is full again
+func setLimitHeaders(c *gin.Context, limit Limit, remaining float64) {
+	reset := (float64(limit.Burst) - remaining) / limit.Rate
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(remaining)))))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset))))
+}
+
+// MaxBodySize rejects request bodies larger than limit bytes with 413. Bodies
+// without a declared length are cut off at the limit, which makes them fail
+// to parse.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return MaxBodySizes(limit, nil)
+}
+
+// MaxBodySizes is MaxBodySize with other limits for the routes ending in the
+// keys of routes, e.g. "/import"
+func MaxBodySizes(defaultLimit int64, routes map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := defaultLimit
+		for suffix, routeLimit := range routes {
+			if strings.HasSuffix(c.FullPath(), suffix) {
+				limit = routeLimit
+			}
+		}
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("request body is larger than %d bytes", limit),
+			})
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
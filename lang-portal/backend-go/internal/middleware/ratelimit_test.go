@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2025, 2, 8, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(func() time.Time { return now })
+
+	r := gin.New()
+	r.Use(rateLimit(RateLimitConfig{
+		PerIP: RouteLimits{
+			Read:  Limit{Rate: 1, Burst: 3},
+			Write: Limit{Rate: 1, Burst: 1},
+			Reset: Limit{Rate: 1.0 / 60, Burst: 1},
+		},
+		PerUser: RouteLimits{Read: Limit{Rate: 1, Burst: 2}},
+	}, l))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/words", ok)
+	r.POST("/api/study_sessions/:id/words/:word_id/review", ok)
+	r.POST("/api/reset_history", ok)
+	r.GET("/healthz", ok)
+
+	request := func(method, path, ip, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != "" {
+			req.Header.Set(UserHeader, user)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := request(http.MethodGet, "/api/words", "10.0.0.1", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass; got %d", i+1, w.Code)
+		}
+	}
+	w := request(http.MethodGet, "/api/words", "10.0.0.1", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After 1; got %d, %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request(http.MethodGet, "/api/words", "10.0.0.2", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected another IP to have its own bucket; got %d", w.Code)
+	}
+	if w := request(http.MethodGet, "/healthz", "10.0.0.1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected probes not to be limited; got %d", w.Code)
+	}
+
+	// Writes and resets have their own, stricter buckets
+	if w := request(http.MethodPost, "/api/study_sessions/1/words/1/review", "10.0.0.1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the first write to pass; got %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/api/study_sessions/1/words/1/review", "10.0.0.1", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second write to be limited; got %d", w.Code)
+	}
+	request(http.MethodPost, "/api/reset_history", "10.0.0.1", "")
+	if w := request(http.MethodPost, "/api/reset_history", "10.0.0.1", ""); w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected to wait a minute between resets; got Retry-After %q", w.Header().Get("Retry-After"))
+	}
+
+	// A user is limited across IPs
+	request(http.MethodGet, "/api/words", "10.0.1.1", "alice")
+	w = request(http.MethodGet, "/api/words", "10.0.1.2", "alice")
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Expected the user bucket to be reported; got %d %v", w.Code, w.Header())
+	}
+	if w := request(http.MethodGet, "/api/words", "10.0.1.3", "alice"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the user to be limited; got %d", w.Code)
+	}
+
+	// Buckets refill over time
+	now = now.Add(2 * time.Second)
+	if w := request(http.MethodGet, "/api/words", "10.0.0.1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the bucket to refill; got %d", w.Code)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	if l, err := ParseLimit("2.5, 10"); err != nil || l.Rate != 2.5 || l.Burst != 10 {
+		t.Errorf("Unexpected limit %+v, %v", l, err)
+	}
+	if l, err := ParseLimit("off"); err != nil || l.enabled() {
+		t.Errorf("Expected off to disable the limit; got %+v, %v", l, err)
+	}
+	for _, value := range []string{"10", "0,5", "5,0", "fast,5"} {
+		if _, err := ParseLimit(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(MaxBodySize(10))
+	r.POST("/", func(c *gin.Context) {
+		var body map[string]string
+		if err := c.BindJSON(&body); err != nil {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"a":"bb"}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a small body to pass; got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"a":"bbbbbbbb"}`)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large body; got %d", w.Code)
+	}
+}
+
+func TestMaxBodySizes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(MaxBodySizes(10, map[string]int64{"/import": 100}))
+	handler := func(c *gin.Context) {
+		var body map[string]string
+		if err := c.BindJSON(&body); err != nil {
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	r.POST("/api/import", handler)
+	r.POST("/api/words", handler)
+
+	body := `{"a":"bbbbbbbb"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the import limit to apply; got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/words", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 on other routes; got %d", w.Code)
+	}
+}
@@ -1,21 +1,54 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+
+	"lang-portal/internal/logging"
+)
+
+// Language codes
+const (
+	LanguageJapanese = "ja"
 )
 
 // Base Models
 type Word struct {
-	ID       int    `json:"id"`
-	Japanese string `json:"japanese"`
-	Romaji   string `json:"romaji"`
-	English  string `json:"english"`
+	ID              int    `json:"id"`
+	Language        string `json:"language"`
+	Term            string `json:"term"`
+	Transliteration string `json:"transliteration"`
+	Meaning         string `json:"meaning"`
 }
 
 type Group struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+}
+
+// LegacyWordFields are the Japanese-specific names of a word's term,
+// transliteration and meaning. They are only filled for Japanese words so
+// clients written before multi-language support keep working.
+type LegacyWordFields struct {
+	Japanese string `json:"japanese,omitempty"`
+	Romaji   string `json:"romaji,omitempty"`
+	English  string `json:"english,omitempty"`
+}
+
+func NewLegacyWordFields(language, term, transliteration, meaning string) LegacyWordFields {
+	if language != LanguageJapanese {
+		return LegacyWordFields{}
+	}
+	return LegacyWordFields{
+		Japanese: term,
+		Romaji:   transliteration,
+		English:  meaning,
+	}
 }
 
 type StudySession struct {
@@ -30,6 +63,17 @@ type StudyActivity struct {
 	Name         string `json:"name"`
 	ThumbnailURL string `json:"thumbnail_url"`
 	Description  string `json:"description"`
+	LaunchURL    string `json:"launch_url"`
+}
+
+type ExampleSentence struct {
+	ID          int       `json:"id"`
+	WordID      int       `json:"word_id"`
+	Sentence    string    `json:"sentence"`
+	Reading     string    `json:"reading"`
+	Translation string    `json:"translation"`
+	Source      string    `json:"source"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type WordReviewItem struct {
@@ -48,31 +92,70 @@ type Pagination struct {
 }
 
 type WordWithStats struct {
-	Japanese     string `json:"japanese"`
-	Romaji       string `json:"romaji"`
-	English      string `json:"english"`
-	CorrectCount int    `json:"correct_count"`
-	WrongCount   int    `json:"wrong_count"`
+	ID              int    `json:"id"`
+	Language        string `json:"language"`
+	Term            string `json:"term"`
+	Transliteration string `json:"transliteration"`
+	Meaning         string `json:"meaning"`
+	LegacyWordFields
+	CorrectCount   int        `json:"correct_count"`
+	WrongCount     int        `json:"wrong_count"`
+	Mastery        string     `json:"mastery"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
+	Groups         []GroupRef `json:"groups"`
+}
+
+// GroupRef names a group a word belongs to
+type GroupRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
 }
 
 type WordDetailResponse struct {
-	Japanese string `json:"japanese"`
-	Romaji   string `json:"romaji"`
-	English  string `json:"english"`
-	Stats    struct {
-		CorrectCount int `json:"correct_count"`
-		WrongCount   int `json:"wrong_count"`
+	ID              int    `json:"id"`
+	Language        string `json:"language"`
+	Term            string `json:"term"`
+	Transliteration string `json:"transliteration"`
+	Meaning         string `json:"meaning"`
+	LegacyWordFields
+	Stats struct {
+		CorrectCount int    `json:"correct_count"`
+		WrongCount   int    `json:"wrong_count"`
+		Mastery      string `json:"mastery"`
 	} `json:"stats"`
-	Groups []GroupWithStats `json:"groups"`
+	LastReviewedAt   *time.Time        `json:"last_reviewed_at"`
+	Groups           []GroupWithStats  `json:"groups"`
+	ExampleSentences []ExampleSentence `json:"example_sentences"`
 }
 
 type GroupWithStats struct {
 	ID        int    `json:"id"`
 	Name      string `json:"name"`
+	Language  string `json:"language"`
+	Kind      string `json:"kind,omitempty"`
 	WordCount int    `json:"word_count,omitempty"`
 	Stats     struct {
 		TotalWordCount int `json:"total_word_count,omitempty"`
 	} `json:"stats,omitempty"`
+	Mastery *MasteryDistribution `json:"mastery,omitempty"`
+	Rules   []GroupRule          `json:"rules,omitempty"`
+}
+
+// GroupRule is one condition of a smart group. A word belongs to the group
+// when it meets all of the group's rules.
+type GroupRule struct {
+	Type    string  `json:"type"`
+	Value   float64 `json:"value,omitempty"`
+	GroupID int     `json:"group_id,omitempty"`
+}
+
+// MasteryDistribution counts words per mastery level
+type MasteryDistribution struct {
+	New      int `json:"new"`
+	Learning int `json:"learning"`
+	Young    int `json:"young"`
+	Mature   int `json:"mature"`
+	Lapsed   int `json:"lapsed"`
 }
 
 type StudySessionResponse struct {
@@ -84,6 +167,59 @@ type StudySessionResponse struct {
 	ReviewItemsCount int       `json:"review_items_count"`
 }
 
+type SessionReview struct {
+	WordID    int       `json:"word_id"`
+	Term      string    `json:"term"`
+	Correct   bool      `json:"correct"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SessionWordChange is a word whose mastery level changed during a session
+type SessionWordChange struct {
+	WordID int    `json:"word_id"`
+	Term   string `json:"term"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type RecommendedGroup struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type StudySessionSummary struct {
+	ID                   int                 `json:"id"`
+	GroupID              int                 `json:"group_id"`
+	GroupName            string              `json:"group_name"`
+	ActivityName         string              `json:"activity_name"`
+	StartedAt            time.Time           `json:"started_at"`
+	EndedAt              *time.Time          `json:"ended_at"`
+	DurationSeconds      int                 `json:"duration_seconds"`
+	ReviewCount          int                 `json:"review_count"`
+	CorrectCount         int                 `json:"correct_count"`
+	WrongCount           int                 `json:"wrong_count"`
+	Accuracy             float64             `json:"accuracy"`
+	Timeline             []SessionReview     `json:"timeline"`
+	Improved             []SessionWordChange `json:"improved"`
+	Regressed            []SessionWordChange `json:"regressed"`
+	NewlyMastered        []SessionWordChange `json:"newly_mastered"`
+	RecommendedNextGroup *RecommendedGroup   `json:"recommended_next_group"`
+}
+
+// StudySessionDetails is the v2 shape of a study session. It ends with its
+// last review, so EndedAt is nil until the first review.
+type StudySessionDetails struct {
+	ID               int        `json:"id"`
+	GroupID          int        `json:"group_id"`
+	GroupName        string     `json:"group_name"`
+	StudyActivityID  int        `json:"study_activity_id"`
+	ActivityName     string     `json:"activity_name"`
+	StartedAt        time.Time  `json:"started_at"`
+	EndedAt          *time.Time `json:"ended_at"`
+	ReviewItemsCount int        `json:"review_items_count"`
+}
+
 type StudyActivitySessionResponse struct {
 	ID              int       `json:"id"`
 	GroupID         int       `json:"group_id"`
@@ -91,6 +227,16 @@ type StudyActivitySessionResponse struct {
 	StudyActivityID int       `json:"study_activity_id"`
 }
 
+type StudySessionLaunchResponse struct {
+	ID              int       `json:"id"`
+	GroupID         int       `json:"group_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	StudyActivityID int       `json:"study_activity_id"`
+	LaunchURL       string    `json:"launch_url"`
+	SessionToken    string    `json:"session_token"`
+	TokenExpiresAt  time.Time `json:"token_expires_at"`
+}
+
 type LastStudySessionResponse struct {
 	ID              int       `json:"id"`
 	GroupID         int       `json:"group_id"`
@@ -121,10 +267,293 @@ type GroupsResponse struct {
 	Pagination *Pagination     `json:"pagination"`
 }
 
+type QuizQuestion struct {
+	ID      int      `json:"id"`
+	WordID  int      `json:"word_id"`
+	Prompt  string   `json:"prompt"`
+	Choices []string `json:"choices"`
+}
+
+type QuizResponse struct {
+	StudySessionID int            `json:"study_session_id"`
+	GroupID        int            `json:"group_id"`
+	Direction      string         `json:"direction"`
+	Seed           int64          `json:"seed"`
+	Questions      []QuizQuestion `json:"questions"`
+}
+
+type QuizAnswer struct {
+	WordID int    `json:"word_id"`
+	Answer string `json:"answer"`
+	// ResponseTimeMs is the time the learner took to answer, if known
+	ResponseTimeMs int `json:"response_time_ms"`
+}
+
+type QuizAnswerResult struct {
+	WordID        int    `json:"word_id"`
+	Answer        string `json:"answer"`
+	CorrectAnswer string `json:"correct_answer"`
+	Correct       bool   `json:"correct"`
+}
+
+type QuizGradeResponse struct {
+	StudySessionID int                `json:"study_session_id"`
+	Direction      string             `json:"direction"`
+	CorrectCount   int                `json:"correct_count"`
+	TotalCount     int                `json:"total_count"`
+	Score          float64            `json:"score"`
+	Results        []QuizAnswerResult `json:"results"`
+}
+
+type DailyGoal struct {
+	GoalType string `json:"goal_type"`
+	Target   int    `json:"target"`
+}
+
+// LeechThresholds are the number of wrong answers or lapses after which a
+// word that is not learned yet counts as a leech
+type LeechThresholds struct {
+	Failures int `json:"failures"`
+	Lapses   int `json:"lapses"`
+}
+
+type SettingsResponse struct {
+	Timezone        string          `json:"timezone"`
+	DailyGoal       *DailyGoal      `json:"daily_goal"`
+	LeechThresholds LeechThresholds `json:"leech_thresholds"`
+}
+
+type DailyGoalProgress struct {
+	Date      string     `json:"date"`
+	Reviews   int        `json:"reviews"`
+	Minutes   float64    `json:"minutes"`
+	Goal      *DailyGoal `json:"goal"`
+	Completed bool       `json:"completed"`
+}
+
+type GoalHistoryResponse struct {
+	Timezone       string              `json:"timezone"`
+	CurrentGoal    *DailyGoal          `json:"current_goal"`
+	CompletedDays  int                 `json:"completed_days"`
+	GoalStreakDays int                 `json:"goal_streak_days"`
+	Items          []DailyGoalProgress `json:"items"`
+}
+
+type LeechFailure struct {
+	StudySessionID int       `json:"study_session_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type Leech struct {
+	WordID          int    `json:"word_id"`
+	Language        string `json:"language"`
+	Term            string `json:"term"`
+	Transliteration string `json:"transliteration"`
+	Meaning         string `json:"meaning"`
+	LegacyWordFields
+	CorrectCount int            `json:"correct_count"`
+	WrongCount   int            `json:"wrong_count"`
+	Lapses       int            `json:"lapses"`
+	Mastery      string         `json:"mastery"`
+	LastFailedAt *time.Time     `json:"last_failed_at"`
+	Failures     []LeechFailure `json:"failures"`
+}
+
+type ActivityBucket struct {
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	Reviews      int     `json:"reviews"`
+	CorrectCount int     `json:"correct_count"`
+	Accuracy     float64 `json:"accuracy"`
+	Sessions     int     `json:"sessions"`
+	NewWords     int     `json:"new_words"`
+}
+
+type ActivityResponse struct {
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	Bucket   string           `json:"bucket"`
+	Timezone string           `json:"timezone"`
+	Items    []ActivityBucket `json:"items"`
+}
+
+// WordReview is one answer to a word, with the session it was given in
+type WordReview struct {
+	StudySessionID    int       `json:"study_session_id"`
+	GroupID           int       `json:"group_id"`
+	GroupName         string    `json:"group_name"`
+	StudyActivityID   int       `json:"study_activity_id"`
+	StudyActivityName string    `json:"study_activity_name"`
+	Correct           bool      `json:"correct"`
+	ResponseTimeMs    *int      `json:"response_time_ms"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type WordReviewStats struct {
+	TotalReviews int `json:"total_reviews"`
+	CorrectCount int `json:"correct_count"`
+	WrongCount   int `json:"wrong_count"`
+	// CurrentCorrectStreak counts the correct answers since the last wrong one
+	CurrentCorrectStreak int        `json:"current_correct_streak"`
+	LastReviewedAt       *time.Time `json:"last_reviewed_at"`
+	// RecentAccuracy is the percentage of correct answers among the last
+	// RecentReviews reviews, or nil without reviews
+	RecentReviews  int      `json:"recent_reviews"`
+	RecentAccuracy *float64 `json:"recent_accuracy"`
+	// AverageResponseTimeMs only covers reviews with a response time
+	AverageResponseTimeMs *float64 `json:"average_response_time_ms"`
+}
+
+type WordReviewHistory struct {
+	WordID     int             `json:"word_id"`
+	Items      []WordReview    `json:"items"`
+	Pagination *Pagination     `json:"pagination"`
+	Stats      WordReviewStats `json:"stats"`
+}
+
+// Archive is the export of the learning data. Rows refer to each other by
+// the IDs of the exporting database; imports assign new ones.
+type Archive struct {
+	Format           string                 `json:"format"`
+	Version          int                    `json:"version"`
+	ExportedAt       time.Time              `json:"exported_at"`
+	Words            []ArchiveWord          `json:"words"`
+	Groups           []ArchiveGroup         `json:"groups"`
+	WordGroups       []ArchiveWordGroup     `json:"word_groups"`
+	StudyActivities  []ArchiveStudyActivity `json:"study_activities"`
+	StudySessions    []ArchiveStudySession  `json:"study_sessions"`
+	WordReviews      []ArchiveWordReview    `json:"word_reviews"`
+	ExampleSentences []ExampleSentence      `json:"example_sentences"`
+}
+
+type ArchiveWord struct {
+	ID              int        `json:"id"`
+	Language        string     `json:"language"`
+	Term            string     `json:"term"`
+	Transliteration string     `json:"transliteration"`
+	Meaning         string     `json:"meaning"`
+	CreatedAt       *time.Time `json:"created_at"`
+}
+
+type ArchiveGroup struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name"`
+	Language string      `json:"language"`
+	Kind     string      `json:"kind"`
+	Rules    []GroupRule `json:"rules,omitempty"`
+}
+
+type ArchiveWordGroup struct {
+	WordID  int `json:"word_id"`
+	GroupID int `json:"group_id"`
+}
+
+type ArchiveStudyActivity struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Description  string `json:"description"`
+	LaunchURL    string `json:"launch_url"`
+}
+
+type ArchiveStudySession struct {
+	ID              int       `json:"id"`
+	GroupID         int       `json:"group_id"`
+	StudyActivityID int       `json:"study_activity_id"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ArchiveWordReview struct {
+	WordID         int       `json:"word_id"`
+	StudySessionID int       `json:"study_session_id"`
+	Correct        bool      `json:"correct"`
+	ResponseTimeMs *int      `json:"response_time_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ImportCounts counts the rows of one kind in an imported archive
+type ImportCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	// Skipped rows matched existing ones or referred to rows missing from
+	// the archive
+	Skipped int `json:"skipped"`
+}
+
+type ImportResult struct {
+	OnConflict       string       `json:"on_conflict"`
+	Words            ImportCounts `json:"words"`
+	Groups           ImportCounts `json:"groups"`
+	WordGroups       ImportCounts `json:"word_groups"`
+	StudyActivities  ImportCounts `json:"study_activities"`
+	StudySessions    ImportCounts `json:"study_sessions"`
+	WordReviews      ImportCounts `json:"word_reviews"`
+	ExampleSentences ImportCounts `json:"example_sentences"`
+}
+
+// TrashItem is a deleted word, group, study session or study activity
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type Webhook struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Secret is only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	EventID        uint64     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus *int       `json:"response_status"`
+	LastError      *string    `json:"last_error"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	ReplayOf       *int       `json:"replay_of"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// DB runs its queries in a context, so they can be cancelled with the
+// request and their errors are logged with the request ID
 type DB struct {
 	*sql.DB
+	ctx       context.Context
+	observers []QueryObserver
+	version   *dataVersion
+	untracked bool
+	label     string
 }
 
+// dataVersion counts the writes made through a DB and its copies
+type dataVersion struct {
+	mu       sync.Mutex
+	version  uint64
+	modified time.Time
+}
+
+func (v *dataVersion) bump() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.version++
+	v.modified = time.Now()
+}
+
+// QueryObserver is told about every query run through a DB, with the label of
+// the DB, the time it started and its error, e.g. to record metrics
+type QueryObserver func(ctx context.Context, label, query string, start time.Time, err error)
+
 func NewDB(dataSourceName string) (*DB, error) {
 	db, err := sql.Open("sqlite3", dataSourceName)
 	if err != nil {
@@ -133,5 +562,168 @@ func NewDB(dataSourceName string) (*DB, error) {
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+	return &DB{DB: db, version: &dataVersion{modified: time.Now()}}, nil
+}
+
+// WithContext returns a copy of db that runs its queries in ctx
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// Labeled returns a copy of db whose queries are observed under label, such
+// as the service method that runs them. A labeled db keeps its label, so the
+// queries of nested calls count towards the outermost one.
+func (db *DB) Labeled(label string) *DB {
+	if db.label != "" {
+		return db
+	}
+	c := *db
+	c.label = label
+	return &c
+}
+
+// Untracked returns a copy of db whose writes are left out of the data
+// version, for bookkeeping that read responses do not show
+func (db *DB) Untracked() *DB {
+	c := *db
+	c.untracked = true
+	return &c
+}
+
+// bump counts a write unless db is untracked
+func (db *DB) bump() {
+	if !db.untracked {
+		db.version.bump()
+	}
+}
+
+// DataVersion returns a counter that grows with every write through db and
+// the time of the last write, or of opening db. Writes made by other
+// processes are not counted.
+func (db *DB) DataVersion() (uint64, time.Time) {
+	db.version.mu.Lock()
+	defer db.version.mu.Unlock()
+	return db.version.version, db.version.modified
+}
+
+// isWrite tells statements that change data, which may also be run with
+// Query when they return rows. Any write keyword counts, wherever it is, so
+// writes behind a WITH clause or a comment are not missed; a read that only
+// mentions one merely costs a cache refresh.
+func isWrite(query string) bool {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, word := range words {
+		switch strings.ToUpper(word) {
+		case "INSERT", "UPDATE", "DELETE", "REPLACE":
+			return true
+		}
+	}
+	return false
+}
+
+// Observe adds an observer of the queries of db and of its later copies
+func (db *DB) Observe(observer QueryObserver) {
+	db.observers = append(db.observers, observer)
+}
+
+// Context returns the context the queries of db run in
+func (db *DB) Context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.QueryContext(db.Context(), query, args...)
+	db.done(query, start, err)
+	if err == nil && isWrite(query) {
+		db.bump()
+	}
+	return rows, err
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := db.DB.QueryRowContext(db.Context(), query, args...)
+	db.done(query, start, row.Err())
+	if row.Err() == nil && isWrite(query) {
+		db.bump()
+	}
+	return row
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := db.DB.ExecContext(db.Context(), query, args...)
+	db.done(query, start, err)
+	if err == nil {
+		db.bump()
+	}
+	return result, err
+}
+
+func (db *DB) done(query string, start time.Time, err error) {
+	for _, observe := range db.observers {
+		observe(db.Context(), db.label, query, start, err)
+	}
+	if err != nil {
+		db.logError(query, err)
+	}
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.BeginTx(db.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+// Tx is a transaction whose statements are observed and logged like those of its DB
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+// Commit commits the transaction and counts it as a write of its DB
+func (tx *Tx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+	tx.db.bump()
+	return nil
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := tx.Tx.QueryContext(tx.db.Context(), query, args...)
+	tx.db.done(query, start, err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := tx.Tx.QueryRowContext(tx.db.Context(), query, args...)
+	tx.db.done(query, start, row.Err())
+	return row
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := tx.Tx.ExecContext(tx.db.Context(), query, args...)
+	tx.db.done(query, start, err)
+	return result, err
+}
+
+func (db *DB) logError(query string, err error) {
+	logging.FromContext(db.Context()).Error("sql query failed",
+		"query", strings.Join(strings.Fields(query), " "),
+		"error", err,
+	)
 }
\ No newline at end of file
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"lang-portal/internal/models"
+)
+
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// MaxActivityBuckets bounds the size of an activity response
+const MaxActivityBuckets = 1000
+
+// bucketStart returns the local date that starts the bucket containing t.
+// Weeks start on Monday.
+func bucketStart(t time.Time, bucket string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch bucket {
+	case BucketWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case BucketMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// GetActivity returns review, accuracy, session and new word counts per day,
+// week or month between the local dates from and to, both inclusive. Every
+// bucket in the range is returned, including those without any activity.
+// Empty from and to default to the last 30 days.
+func (s *DashboardService) GetActivity(from, to, bucket, language string) (*models.ActivityResponse, error) {
+	s = s.labeled("GetActivity")
+	if bucket != BucketDay && bucket != BucketWeek && bucket != BucketMonth {
+		return nil, fmt.Errorf("invalid bucket %q", bucket)
+	}
+
+	location, err := loadUserLocation(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	today := bucketStart(time.Now().In(location), BucketDay)
+	toDate, fromDate := today, today.AddDate(0, 0, -29)
+	if to != "" {
+		if toDate, err = time.ParseInLocation(dateLayout, to, location); err != nil {
+			return nil, fmt.Errorf("invalid to date %q", to)
+		}
+	}
+	if from != "" {
+		if fromDate, err = time.ParseInLocation(dateLayout, from, location); err != nil {
+			return nil, fmt.Errorf("invalid from date %q", from)
+		}
+	} else if to != "" {
+		fromDate = toDate.AddDate(0, 0, -29)
+	}
+	if fromDate.After(toDate) {
+		return nil, fmt.Errorf("invalid range: from is after to")
+	}
+
+	// Buckets cover whole weeks or months around the requested range
+	var starts []time.Time
+	index := make(map[string]int)
+	for start := bucketStart(fromDate, bucket); !start.After(toDate); start = nextBucket(start, bucket) {
+		if len(starts) == MaxActivityBuckets {
+			return nil, fmt.Errorf("invalid range: more than %d buckets", MaxActivityBuckets)
+		}
+		index[start.Format(dateLayout)] = len(starts)
+		starts = append(starts, start)
+	}
+
+	rangeStart := starts[0].UTC().Format("2006-01-02 15:04:05")
+	rangeEnd := nextBucket(starts[len(starts)-1], bucket).UTC().Format("2006-01-02 15:04:05")
+
+	buckets := make([]models.ActivityBucket, len(starts))
+	for i, start := range starts {
+		buckets[i].Start = start.Format(dateLayout)
+		buckets[i].End = nextBucket(start, bucket).AddDate(0, 0, -1).Format(dateLayout)
+	}
+	bucketFor := func(t time.Time) *models.ActivityBucket {
+		if i, ok := index[bucketStart(t.In(location), bucket).Format(dateLayout)]; ok {
+			return &buckets[i]
+		}
+		return nil
+	}
+
+	reviewsQuery := `
+		SELECT wri.created_at, wri.correct
+		FROM word_review_items wri
+		JOIN words w ON wri.word_id = w.id
+		WHERE wri.created_at >= ? AND wri.created_at < ?
+		AND (? = '' OR w.language = ?)
+		AND wri.deleted_at IS NULL AND w.deleted_at IS NULL
+	`
+	reviewRows, err := s.db.Query(reviewsQuery, rangeStart, rangeEnd, language, language)
+	if err != nil {
+		return nil, err
+	}
+	defer reviewRows.Close()
+	for reviewRows.Next() {
+		var createdAt time.Time
+		var correct bool
+		if err := reviewRows.Scan(&createdAt, &correct); err != nil {
+			return nil, err
+		}
+		if b := bucketFor(createdAt); b != nil {
+			b.Reviews++
+			if correct {
+				b.CorrectCount++
+			}
+		}
+	}
+	if err := reviewRows.Err(); err != nil {
+		return nil, err
+	}
+
+	sessionsQuery := `
+		SELECT ss.created_at
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		WHERE ss.created_at >= ? AND ss.created_at < ?
+		AND (? = '' OR g.language = ?)
+		AND ss.deleted_at IS NULL AND g.deleted_at IS NULL
+	`
+	sessionRows, err := s.db.Query(sessionsQuery, rangeStart, rangeEnd, language, language)
+	if err != nil {
+		return nil, err
+	}
+	defer sessionRows.Close()
+	for sessionRows.Next() {
+		var createdAt time.Time
+		if err := sessionRows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		if b := bucketFor(createdAt); b != nil {
+			b.Sessions++
+		}
+	}
+	if err := sessionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A word is new in the bucket of its first ever review
+	newWordsQuery := `
+		SELECT MIN(wri.created_at) as first_review
+		FROM word_review_items wri
+		JOIN words w ON wri.word_id = w.id
+		WHERE (? = '' OR w.language = ?)
+		AND wri.deleted_at IS NULL AND w.deleted_at IS NULL
+		GROUP BY wri.word_id
+		HAVING first_review >= ? AND first_review < ?
+	`
+	newWordRows, err := s.db.Query(newWordsQuery, language, language, rangeStart, rangeEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer newWordRows.Close()
+	for newWordRows.Next() {
+		var firstReview string
+		if err := newWordRows.Scan(&firstReview); err != nil {
+			return nil, err
+		}
+		reviewedAt, err := parseTimestamp(firstReview)
+		if err != nil {
+			return nil, err
+		}
+		if b := bucketFor(reviewedAt); b != nil {
+			b.NewWords++
+		}
+	}
+	if err := newWordRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range buckets {
+		if buckets[i].Reviews > 0 {
+			accuracy := float64(buckets[i].CorrectCount) / float64(buckets[i].Reviews) * 100
+			buckets[i].Accuracy = math.Round(accuracy*10) / 10
+		}
+	}
+
+	return &models.ActivityResponse{
+		From:     fromDate.Format(dateLayout),
+		To:       toDate.Format(dateLayout),
+		Bucket:   bucket,
+		Timezone: location.String(),
+		Items:    buckets,
+	}, nil
+}
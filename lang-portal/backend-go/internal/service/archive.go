@@ -0,0 +1,678 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/logging"
+	"lang-portal/internal/models"
+)
+
+// Archive format of exports. Imports accept archives up to ArchiveVersion.
+const (
+	ArchiveFormat  = "lang-portal-archive"
+	ArchiveVersion = 1
+)
+
+// Conflict policies of imports, for imported rows that match existing ones
+const (
+	// ImportSkip keeps the existing row and links imported rows to it
+	ImportSkip = "skip"
+	// ImportOverwrite replaces the existing row with the imported one
+	ImportOverwrite = "overwrite"
+	// ImportFail aborts the import without changes
+	ImportFail = "fail"
+)
+
+type ArchiveService struct {
+	db *models.DB
+}
+
+func NewArchiveService(db *models.DB) *ArchiveService {
+	return &ArchiveService{db: db}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *ArchiveService) WithContext(ctx context.Context) *ArchiveService {
+	return &ArchiveService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *ArchiveService) labeled(method string) *ArchiveService {
+	c := *s
+	c.db = s.db.Labeled("ArchiveService." + method)
+	return &c
+}
+
+// Export writes the learning data to w as a JSON archive. The data is read
+// in one transaction, so the archive is consistent, and before anything is
+// written, so a slow client does not hold up writers.
+func (s *ArchiveService) Export(w io.Writer) error {
+	s = s.labeled("Export")
+	archive, err := s.readArchive()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(archive)
+}
+
+func (s *ArchiveService) readArchive() (*models.Archive, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	archive := &models.Archive{
+		Format:           ArchiveFormat,
+		Version:          ArchiveVersion,
+		ExportedAt:       time.Now().UTC(),
+		Words:            make([]models.ArchiveWord, 0),
+		Groups:           make([]models.ArchiveGroup, 0),
+		WordGroups:       make([]models.ArchiveWordGroup, 0),
+		StudyActivities:  make([]models.ArchiveStudyActivity, 0),
+		StudySessions:    make([]models.ArchiveStudySession, 0),
+		WordReviews:      make([]models.ArchiveWordReview, 0),
+		ExampleSentences: make([]models.ExampleSentence, 0),
+	}
+
+	err = eachRow(tx, `
+		SELECT id, language, term, transliteration, meaning, created_at
+		FROM words WHERE deleted_at IS NULL ORDER BY id
+	`, func(rows *sql.Rows) error {
+		var word models.ArchiveWord
+		var createdAt sql.NullTime
+		if err := rows.Scan(&word.ID, &word.Language, &word.Term, &word.Transliteration, &word.Meaning, &createdAt); err != nil {
+			return err
+		}
+		if createdAt.Valid {
+			word.CreatedAt = &createdAt.Time
+		}
+		archive.Words = append(archive.Words, word)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(tx, `SELECT id, name, language, kind, rules FROM groups WHERE deleted_at IS NULL ORDER BY id`, func(rows *sql.Rows) error {
+		var group models.ArchiveGroup
+		var rules sql.NullString
+		if err := rows.Scan(&group.ID, &group.Name, &group.Language, &group.Kind, &rules); err != nil {
+			return err
+		}
+		if rules.Valid {
+			parsed, err := parseGroupRules(rules.String)
+			if err != nil {
+				return err
+			}
+			group.Rules = parsed
+		}
+		archive.Groups = append(archive.Groups, group)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(tx, `
+		SELECT word_id, group_id FROM words_groups
+		WHERE word_id IN (SELECT id FROM words WHERE deleted_at IS NULL)
+		AND group_id IN (SELECT id FROM groups WHERE deleted_at IS NULL)
+		ORDER BY id
+	`, func(rows *sql.Rows) error {
+		var membership models.ArchiveWordGroup
+		if err := rows.Scan(&membership.WordID, &membership.GroupID); err != nil {
+			return err
+		}
+		archive.WordGroups = append(archive.WordGroups, membership)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(tx, `
+		SELECT id, name, COALESCE(thumbnail_url, ''), COALESCE(description, ''), COALESCE(launch_url, '')
+		FROM study_activities WHERE deleted_at IS NULL ORDER BY id
+	`, func(rows *sql.Rows) error {
+		var activity models.ArchiveStudyActivity
+		if err := rows.Scan(&activity.ID, &activity.Name, &activity.ThumbnailURL, &activity.Description, &activity.LaunchURL); err != nil {
+			return err
+		}
+		archive.StudyActivities = append(archive.StudyActivities, activity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(tx, `SELECT id, group_id, study_activity_id, created_at FROM study_sessions WHERE deleted_at IS NULL ORDER BY id`, func(rows *sql.Rows) error {
+		var session models.ArchiveStudySession
+		if err := rows.Scan(&session.ID, &session.GroupID, &session.StudyActivityID, &session.CreatedAt); err != nil {
+			return err
+		}
+		archive.StudySessions = append(archive.StudySessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(tx, `
+		SELECT word_id, study_session_id, correct, response_time_ms, created_at
+		FROM word_review_items WHERE deleted_at IS NULL ORDER BY created_at, rowid
+	`, func(rows *sql.Rows) error {
+		var review models.ArchiveWordReview
+		var responseTime sql.NullInt64
+		if err := rows.Scan(&review.WordID, &review.StudySessionID, &review.Correct, &responseTime, &review.CreatedAt); err != nil {
+			return err
+		}
+		if responseTime.Valid {
+			ms := int(responseTime.Int64)
+			review.ResponseTimeMs = &ms
+		}
+		archive.WordReviews = append(archive.WordReviews, review)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(tx, `
+		SELECT `+sentenceColumns+` FROM example_sentences es
+		WHERE es.word_id IN (SELECT id FROM words WHERE deleted_at IS NULL)
+		ORDER BY es.id
+	`, func(rows *sql.Rows) error {
+		var sentence models.ExampleSentence
+		if err := rows.Scan(&sentence.ID, &sentence.WordID, &sentence.Sentence, &sentence.Reading, &sentence.Translation, &sentence.Source, &sentence.CreatedAt); err != nil {
+			return err
+		}
+		archive.ExampleSentences = append(archive.ExampleSentences, sentence)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// eachRow calls scan for every row of query
+func eachRow(tx *models.Tx, query string, scan func(*sql.Rows) error) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Import adds the data of an archive read from r. Rows get new IDs, and the
+// rows referring to them are linked up accordingly. Imported rows that match
+// existing ones are handled by the onConflict policy:
+//   - words match on language, term and transliteration
+//   - groups on name, and trouble words groups on language
+//   - study activities on name
+//   - study sessions on group, activity and start
+//   - word reviews on word, session and time, among live reviews
+//   - example sentences on word and sentence
+//
+// Trouble words are not imported but recomputed from the merged history.
+func (s *ArchiveService) Import(r io.Reader, onConflict string) (*models.ImportResult, error) {
+	s = s.labeled("Import")
+	switch onConflict {
+	case ImportSkip, ImportOverwrite, ImportFail:
+	default:
+		return nil, fmt.Errorf("invalid on_conflict %q", onConflict)
+	}
+
+	var archive models.Archive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	if archive.Format != ArchiveFormat {
+		return nil, fmt.Errorf("invalid archive: unknown format %q", archive.Format)
+	}
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		return nil, fmt.Errorf("invalid archive: version %d is not supported", archive.Version)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	im := &importer{
+		tx:          tx,
+		onConflict:  onConflict,
+		result:      &models.ImportResult{OnConflict: onConflict},
+		words:       make(map[int]int),
+		groups:      make(map[int]int),
+		leechGroups: make(map[int]bool),
+		activities:  make(map[int]int),
+		sessions:    make(map[int]int),
+	}
+	steps := []func(*models.Archive) error{
+		im.importWords,
+		im.importGroups,
+		im.importWordGroups,
+		im.importStudyActivities,
+		im.importStudySessions,
+		im.importWordReviews,
+		im.importExampleSentences,
+	}
+	for _, step := range steps {
+		if err := step(&archive); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	refreshTroubleWordsAfter(s.db, "1 = 1")
+	logging.FromContext(s.db.Context()).Info("archive imported", "on_conflict", onConflict,
+		"words", im.result.Words.Created, "word_reviews", im.result.WordReviews.Created)
+	events.PublishShared(events.DataImported, im.result)
+
+	return im.result, nil
+}
+
+// importer imports an archive in one transaction. The maps translate IDs of
+// the archive to those of the database.
+type importer struct {
+	tx          *models.Tx
+	onConflict  string
+	result      *models.ImportResult
+	words       map[int]int
+	groups      map[int]int
+	leechGroups map[int]bool
+	activities  map[int]int
+	sessions    map[int]int
+}
+
+// conflict handles an imported row that matches an existing one and returns
+// whether to overwrite it
+func (im *importer) conflict(counts *models.ImportCounts, row string) (bool, error) {
+	switch im.onConflict {
+	case ImportOverwrite:
+		counts.Updated++
+		return true, nil
+	case ImportFail:
+		return false, fmt.Errorf("import conflict: %s already exists", row)
+	}
+	counts.Skipped++
+	return false, nil
+}
+
+// maxID is the highest ID of table before the import. Imported rows are only
+// matched against older ones, so duplicates within the archive are kept.
+func (im *importer) maxID(table string) (int, error) {
+	var id int
+	err := im.tx.QueryRow("SELECT COALESCE(MAX(id), 0) FROM " + table).Scan(&id)
+	return id, err
+}
+
+// insert runs an INSERT and returns the ID of the new row
+func (im *importer) insert(query string, args ...interface{}) (int, error) {
+	result, err := im.tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// sqliteTime formats t like CURRENT_TIMESTAMP, so imported times compare
+// with those of SQLite
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (im *importer) importWords(archive *models.Archive) error {
+	existing, err := im.maxID("words")
+	if err != nil {
+		return err
+	}
+	counts := &im.result.Words
+	for _, word := range archive.Words {
+		if word.Language == "" {
+			word.Language = "ja"
+		}
+		var id int
+		err := im.tx.QueryRow(`
+			SELECT id FROM words
+			WHERE language = ? AND term = ? AND transliteration = ? AND id <= ? AND deleted_at IS NULL
+			ORDER BY id LIMIT 1
+		`, word.Language, word.Term, word.Transliteration, existing).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			var createdAt interface{}
+			if word.CreatedAt != nil {
+				createdAt = sqliteTime(*word.CreatedAt)
+			}
+			id, err = im.insert(
+				"INSERT INTO words (language, term, transliteration, meaning, created_at) VALUES (?, ?, ?, ?, ?)",
+				word.Language, word.Term, word.Transliteration, word.Meaning, createdAt,
+			)
+			if err != nil {
+				return err
+			}
+			counts.Created++
+		case err != nil:
+			return err
+		default:
+			overwrite, err := im.conflict(counts, fmt.Sprintf("word %q", word.Term))
+			if err != nil {
+				return err
+			}
+			if overwrite {
+				if _, err := im.tx.Exec("UPDATE words SET meaning = ? WHERE id = ?", word.Meaning, id); err != nil {
+					return err
+				}
+			}
+		}
+		im.words[word.ID] = id
+	}
+	return nil
+}
+
+func (im *importer) importGroups(archive *models.Archive) error {
+	counts := &im.result.Groups
+	// Rules refer to groups, so they are saved once every group has its ID
+	rules := make(map[int][]models.GroupRule)
+	for _, group := range archive.Groups {
+		if group.Language == "" {
+			group.Language = "ja"
+		}
+		switch group.Kind {
+		case GroupKindStatic, GroupKindSmart:
+		case GroupKindLeeches:
+			// Trouble words groups are maintained by the portal, so the one
+			// of the language is reused
+			var id int
+			err := im.tx.QueryRow("SELECT id FROM groups WHERE kind = ? AND language = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", GroupKindLeeches, group.Language).Scan(&id)
+			if err == nil {
+				counts.Skipped++
+				im.groups[group.ID] = id
+				im.leechGroups[group.ID] = true
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+			im.leechGroups[group.ID] = true
+		default:
+			return fmt.Errorf("invalid archive: group %q has unknown kind %q", group.Name, group.Kind)
+		}
+
+		var id int
+		var deleted bool
+		err := im.tx.QueryRow("SELECT id, deleted_at IS NOT NULL FROM groups WHERE name = ?", group.Name).Scan(&id, &deleted)
+		switch {
+		case err == nil && deleted:
+			// Group names stay taken while the group is in the trash
+			return fmt.Errorf("import conflict: group %q is in the trash", group.Name)
+		case err == sql.ErrNoRows:
+			if id, err = im.insert("INSERT INTO groups (name, language, kind) VALUES (?, ?, ?)", group.Name, group.Language, group.Kind); err != nil {
+				return err
+			}
+			counts.Created++
+		case err != nil:
+			return err
+		default:
+			overwrite, err := im.conflict(counts, fmt.Sprintf("group %q", group.Name))
+			if err != nil {
+				return err
+			}
+			if !overwrite {
+				im.groups[group.ID] = id
+				continue
+			}
+			if _, err := im.tx.Exec("UPDATE groups SET language = ?, kind = ?, rules = NULL WHERE id = ?", group.Language, group.Kind, id); err != nil {
+				return err
+			}
+		}
+		im.groups[group.ID] = id
+		if group.Kind == GroupKindSmart {
+			rules[id] = group.Rules
+		}
+	}
+
+	for id, groupRules := range rules {
+		remapped := make([]models.GroupRule, len(groupRules))
+		for i, rule := range groupRules {
+			// Rules of groups missing from the archive keep referring to no group
+			if rule.GroupID != 0 {
+				rule.GroupID = im.groups[rule.GroupID]
+			}
+			remapped[i] = rule
+		}
+		encoded, err := json.Marshal(remapped)
+		if err != nil {
+			return err
+		}
+		if _, err := im.tx.Exec("UPDATE groups SET rules = ? WHERE id = ?", string(encoded), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) importWordGroups(archive *models.Archive) error {
+	counts := &im.result.WordGroups
+	for _, membership := range archive.WordGroups {
+		wordID, wordOK := im.words[membership.WordID]
+		groupID, groupOK := im.groups[membership.GroupID]
+		if !wordOK || !groupOK || im.leechGroups[membership.GroupID] {
+			counts.Skipped++
+			continue
+		}
+		var exists bool
+		if err := im.tx.QueryRow("SELECT EXISTS(SELECT 1 FROM words_groups WHERE word_id = ? AND group_id = ?)", wordID, groupID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			counts.Skipped++
+			continue
+		}
+		if _, err := im.tx.Exec("INSERT INTO words_groups (word_id, group_id) VALUES (?, ?)", wordID, groupID); err != nil {
+			return err
+		}
+		counts.Created++
+	}
+	return nil
+}
+
+func (im *importer) importStudyActivities(archive *models.Archive) error {
+	existing, err := im.maxID("study_activities")
+	if err != nil {
+		return err
+	}
+	counts := &im.result.StudyActivities
+	for _, activity := range archive.StudyActivities {
+		var id int
+		err := im.tx.QueryRow("SELECT id FROM study_activities WHERE name = ? AND id <= ? AND deleted_at IS NULL ORDER BY id LIMIT 1", activity.Name, existing).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			id, err = im.insert(`
+				INSERT INTO study_activities (name, thumbnail_url, description, launch_url)
+				VALUES (?, ?, ?, NULLIF(?, ''))
+			`, activity.Name, activity.ThumbnailURL, activity.Description, activity.LaunchURL)
+			if err != nil {
+				return err
+			}
+			counts.Created++
+		case err != nil:
+			return err
+		default:
+			overwrite, err := im.conflict(counts, fmt.Sprintf("study activity %q", activity.Name))
+			if err != nil {
+				return err
+			}
+			if overwrite {
+				if _, err := im.tx.Exec(`
+					UPDATE study_activities SET thumbnail_url = ?, description = ?, launch_url = NULLIF(?, '')
+					WHERE id = ?
+				`, activity.ThumbnailURL, activity.Description, activity.LaunchURL, id); err != nil {
+					return err
+				}
+			}
+		}
+		im.activities[activity.ID] = id
+	}
+	return nil
+}
+
+func (im *importer) importStudySessions(archive *models.Archive) error {
+	existing, err := im.maxID("study_sessions")
+	if err != nil {
+		return err
+	}
+	counts := &im.result.StudySessions
+	for _, session := range archive.StudySessions {
+		groupID, groupOK := im.groups[session.GroupID]
+		activityID, activityOK := im.activities[session.StudyActivityID]
+		if !groupOK || !activityOK {
+			counts.Skipped++
+			continue
+		}
+		createdAt := sqliteTime(session.CreatedAt)
+		var id int
+		err := im.tx.QueryRow(`
+			SELECT id FROM study_sessions
+			WHERE group_id = ? AND study_activity_id = ? AND created_at = ? AND id <= ? AND deleted_at IS NULL
+			ORDER BY id LIMIT 1
+		`, groupID, activityID, createdAt, existing).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			id, err = im.insert("INSERT INTO study_sessions (group_id, study_activity_id, created_at) VALUES (?, ?, ?)", groupID, activityID, createdAt)
+			if err != nil {
+				return err
+			}
+			counts.Created++
+		case err != nil:
+			return err
+		default:
+			// A matching session has nothing to overwrite; its reviews
+			// are merged below
+			if im.onConflict == ImportFail {
+				return fmt.Errorf("import conflict: study session started at %s already exists", createdAt)
+			}
+			counts.Skipped++
+		}
+		im.sessions[session.ID] = id
+	}
+	return nil
+}
+
+func (im *importer) importWordReviews(archive *models.Archive) error {
+	existing, err := im.maxID("word_review_items")
+	if err != nil {
+		return err
+	}
+	counts := &im.result.WordReviews
+	for _, review := range archive.WordReviews {
+		wordID, wordOK := im.words[review.WordID]
+		sessionID, sessionOK := im.sessions[review.StudySessionID]
+		if !wordOK || !sessionOK {
+			counts.Skipped++
+			continue
+		}
+		// A word can be reviewed more than once in a session, so only a
+		// live review at the same time is the same review
+		createdAt := sqliteTime(review.CreatedAt)
+		var id int
+		err := im.tx.QueryRow(`
+			SELECT id FROM word_review_items
+			WHERE word_id = ? AND study_session_id = ? AND created_at = ? AND id <= ? AND deleted_at IS NULL
+			ORDER BY id LIMIT 1
+		`, wordID, sessionID, createdAt, existing).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := im.tx.Exec(`
+				INSERT INTO word_review_items (word_id, study_session_id, correct, response_time_ms, created_at)
+				VALUES (?, ?, ?, ?, ?)
+			`, wordID, sessionID, review.Correct, review.ResponseTimeMs, createdAt); err != nil {
+				return err
+			}
+			counts.Created++
+		case err != nil:
+			return err
+		default:
+			overwrite, err := im.conflict(counts, fmt.Sprintf("review of word %d in study session %d at %s", wordID, sessionID, createdAt))
+			if err != nil {
+				return err
+			}
+			if overwrite {
+				if _, err := im.tx.Exec(`
+					UPDATE word_review_items SET correct = ?, response_time_ms = ?
+					WHERE id = ?
+				`, review.Correct, review.ResponseTimeMs, id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (im *importer) importExampleSentences(archive *models.Archive) error {
+	existing, err := im.maxID("example_sentences")
+	if err != nil {
+		return err
+	}
+	counts := &im.result.ExampleSentences
+	for _, sentence := range archive.ExampleSentences {
+		wordID, ok := im.words[sentence.WordID]
+		if !ok {
+			counts.Skipped++
+			continue
+		}
+		var id int
+		err := im.tx.QueryRow(`
+			SELECT id FROM example_sentences
+			WHERE word_id = ? AND sentence = ? AND id <= ?
+			ORDER BY id LIMIT 1
+		`, wordID, sentence.Sentence, existing).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := im.tx.Exec(`
+				INSERT INTO example_sentences (word_id, sentence, reading, translation, source, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, wordID, sentence.Sentence, sentence.Reading, sentence.Translation, sentence.Source, sqliteTime(sentence.CreatedAt)); err != nil {
+				return err
+			}
+			counts.Created++
+		case err != nil:
+			return err
+		default:
+			overwrite, err := im.conflict(counts, fmt.Sprintf("example sentence %q", sentence.Sentence))
+			if err != nil {
+				return err
+			}
+			if overwrite {
+				if _, err := im.tx.Exec(
+					"UPDATE example_sentences SET reading = ?, translation = ?, source = ? WHERE id = ?",
+					sentence.Reading, sentence.Translation, sentence.Source, id,
+				); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
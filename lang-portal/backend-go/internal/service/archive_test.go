@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func exportArchive(t *testing.T, archives *ArchiveService) *models.Archive {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := archives.Export(&buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	var archive models.Archive
+	if err := json.Unmarshal(buf.Bytes(), &archive); err != nil {
+		t.Fatalf("Failed to decode archive: %v", err)
+	}
+	return &archive
+}
+
+func importArchive(archives *ArchiveService, archive *models.Archive, onConflict string) (*models.ImportResult, error) {
+	encoded, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	return archives.Import(bytes.NewReader(encoded), onConflict)
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := testdb.New(t)
+	if err := NewStudySessionsService(source, nil).ReviewWordTimed(1, 2, true, 1500); err != nil {
+		t.Fatalf("Failed to review word: %v", err)
+	}
+	if _, err := NewGroupsService(source).CreateSmartGroup("Not animals", "ja", []models.GroupRule{{Type: RuleNotInGroup, GroupID: 1}}); err != nil {
+		t.Fatalf("Failed to create smart group: %v", err)
+	}
+	if _, err := NewSentencesService(source).CreateSentence(models.ExampleSentence{WordID: 2, Sentence: "猫がいる", Translation: "There is a cat"}); err != nil {
+		t.Fatalf("Failed to create sentence: %v", err)
+	}
+	archive := exportArchive(t, NewArchiveService(source))
+	if archive.Format != ArchiveFormat || archive.Version != ArchiveVersion || len(archive.Words) != 5 || len(archive.WordReviews) != 1 {
+		t.Fatalf("Unexpected archive %+v", archive)
+	}
+
+	// The target has been used before, so imported rows get other IDs
+	target := testdb.New(t)
+	if _, err := target.Exec(`
+		DELETE FROM words_groups; DELETE FROM study_sessions; DELETE FROM study_activities;
+		DELETE FROM groups; DELETE FROM words;
+	`); err != nil {
+		t.Fatalf("Failed to empty target: %v", err)
+	}
+	archives := NewArchiveService(target)
+	result, err := importArchive(archives, archive, ImportSkip)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if result.Words.Created != 5 || result.Groups.Created != 3 || result.WordGroups.Created != 5 ||
+		result.StudySessions.Created != 1 || result.WordReviews.Created != 1 || result.ExampleSentences.Created != 1 {
+		t.Errorf("Expected everything to be created; got %+v", result)
+	}
+
+	var wordID, sessionID int
+	if err := target.QueryRow(`
+		SELECT wri.word_id, wri.study_session_id FROM word_review_items wri
+		JOIN words w ON w.id = wri.word_id
+		WHERE w.term = '猫' AND wri.correct AND wri.response_time_ms = 1500
+	`).Scan(&wordID, &sessionID); err != nil {
+		t.Fatalf("Expected the review to be imported: %v", err)
+	}
+	if wordID == 2 || sessionID == 1 {
+		t.Errorf("Expected new IDs; got word %d and session %d", wordID, sessionID)
+	}
+	var rules string
+	var animalsID int
+	if err := target.QueryRow("SELECT rules, (SELECT id FROM groups WHERE name = 'Animals') FROM groups WHERE name = 'Not animals'").Scan(&rules, &animalsID); err != nil {
+		t.Fatalf("Failed to read smart group: %v", err)
+	}
+	if want := `[{"type":"not_in_group","group_id":` + strconv.Itoa(animalsID) + `}]`; rules != want {
+		t.Errorf("Rules = %s; want %s", rules, want)
+	}
+
+	// Importing again matches every row
+	result, err = importArchive(archives, archive, ImportSkip)
+	if err != nil {
+		t.Fatalf("Failed to import again: %v", err)
+	}
+	if result.Words.Created != 0 || result.Words.Skipped != 5 || result.WordReviews.Skipped != 1 || result.WordGroups.Created != 0 {
+		t.Errorf("Expected every row to be skipped; got %+v", result)
+	}
+
+	archive.Words[1].Meaning = "kitty"
+	if _, err := importArchive(archives, archive, ImportFail); err == nil || !strings.HasPrefix(err.Error(), "import conflict") {
+		t.Errorf("Expected an import conflict; got %v", err)
+	}
+	result, err = importArchive(archives, archive, ImportOverwrite)
+	if err != nil {
+		t.Fatalf("Failed to import with overwrite: %v", err)
+	}
+	var meaning string
+	if err := target.QueryRow("SELECT meaning FROM words WHERE id = ?", wordID).Scan(&meaning); err != nil || meaning != "kitty" {
+		t.Errorf("Expected the word to be overwritten; got %q, %v", meaning, err)
+	}
+	if result.Words.Updated != 5 {
+		t.Errorf("Expected 5 updated words; got %+v", result.Words)
+	}
+
+	archive.Version = ArchiveVersion + 1
+	if _, err := importArchive(archives, archive, ImportSkip); err == nil || !strings.HasPrefix(err.Error(), "invalid archive") {
+		t.Errorf("Expected newer archives to be rejected; got %v", err)
+	}
+	if _, err := archives.Import(strings.NewReader("{}"), "merge"); err == nil {
+		t.Error("Expected an unknown conflict policy to be rejected")
+	}
+}
+
+func TestImportRepeatReviews(t *testing.T) {
+	source := testdb.New(t)
+	if _, err := source.Exec(`
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(2, 1, 0, '2024-01-01 10:00:00'), (2, 1, 1, '2024-01-01 10:01:00')
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+	archive := exportArchive(t, NewArchiveService(source))
+
+	target := testdb.New(t)
+	if _, err := target.Exec(`
+		DELETE FROM words_groups; DELETE FROM study_sessions; DELETE FROM study_activities;
+		DELETE FROM groups; DELETE FROM words;
+	`); err != nil {
+		t.Fatalf("Failed to empty target: %v", err)
+	}
+	archives := NewArchiveService(target)
+	// Repeat reviews of a word in one session are separate reviews, even
+	// when conflicts fail the import
+	result, err := importArchive(archives, archive, ImportFail)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if result.WordReviews.Created != 2 {
+		t.Errorf("Expected both reviews to be created; got %+v", result.WordReviews)
+	}
+
+	// A deleted review does not match, so importing again restores it
+	if _, err := target.Exec("UPDATE word_review_items SET deleted_at = CURRENT_TIMESTAMP WHERE NOT correct"); err != nil {
+		t.Fatalf("Failed to delete review: %v", err)
+	}
+	result, err = importArchive(archives, archive, ImportSkip)
+	if err != nil {
+		t.Fatalf("Failed to import again: %v", err)
+	}
+	if result.WordReviews.Created != 1 || result.WordReviews.Skipped != 1 {
+		t.Errorf("Expected the deleted review to be created again; got %+v", result.WordReviews)
+	}
+
+	archive.WordReviews[1].Correct = false
+	if _, err := importArchive(archives, archive, ImportOverwrite); err != nil {
+		t.Fatalf("Failed to import with overwrite: %v", err)
+	}
+	var live, correct int
+	if err := target.QueryRow("SELECT COUNT(*), COALESCE(SUM(correct), 0) FROM word_review_items WHERE deleted_at IS NULL").Scan(&live, &correct); err != nil {
+		t.Fatalf("Failed to count reviews: %v", err)
+	}
+	if live != 2 || correct != 0 {
+		t.Errorf("Expected 2 live reviews, both overwritten as wrong; got %d with %d correct", live, correct)
+	}
+}
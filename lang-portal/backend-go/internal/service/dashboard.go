@@ -1,8 +1,10 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"math"
 	"time"
 
 	"lang-portal/internal/models"
@@ -16,6 +18,19 @@ func NewDashboardService(db *models.DB) *DashboardService {
 	return &DashboardService{db: db}
 }
 
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *DashboardService) WithContext(ctx context.Context) *DashboardService {
+	return &DashboardService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *DashboardService) labeled(method string) *DashboardService {
+	c := *s
+	c.db = s.db.Labeled("DashboardService." + method)
+	return &c
+}
+
 type LastStudySession struct {
 	ID              int       `json:"id"`
 	GroupID         int       `json:"group_id"`
@@ -27,6 +42,9 @@ type LastStudySession struct {
 type StudyProgress struct {
 	TotalWordsStudied    int `json:"total_words_studied"`
 	TotalAvailableWords int `json:"total_available_words"`
+	// TotalWordsLearned counts young and mature words
+	TotalWordsLearned int                        `json:"total_words_learned"`
+	Mastery           models.MasteryDistribution `json:"mastery"`
 }
 
 type QuickStats struct {
@@ -34,22 +52,29 @@ type QuickStats struct {
 	TotalStudySessions int     `json:"total_study_sessions"`
 	TotalActiveGroups  int     `json:"total_active_groups"`
 	StudyStreakDays    int     `json:"study_streak_days"`
+	LongestStreakDays  int     `json:"longest_streak_days"`
 	WordsLearned       int     `json:"words_learned"`
 	WordsInProgress    int     `json:"words_in_progress"`
 }
 
-func (s *DashboardService) GetLastStudySession() (*LastStudySession, error) {
+// Dashboard queries take a language code to limit stats to one target
+// language. An empty language covers every language.
+
+func (s *DashboardService) GetLastStudySession(language string) (*LastStudySession, error) {
+	s = s.labeled("GetLastStudySession")
 	query := `
 		SELECT 
 			ss.id, ss.group_id, ss.created_at, ss.study_activity_id, g.name
 		FROM study_sessions ss
 		JOIN groups g ON ss.group_id = g.id
+		WHERE (? = '' OR g.language = ?)
+		AND ss.deleted_at IS NULL AND g.deleted_at IS NULL
 		ORDER BY ss.created_at DESC
 		LIMIT 1
 	`
 	
 	var session LastStudySession
-	err := s.db.QueryRow(query).Scan(
+	err := s.db.QueryRow(query, language, language).Scan(
 		&session.ID,
 		&session.GroupID,
 		&session.CreatedAt,
@@ -65,78 +90,275 @@ func (s *DashboardService) GetLastStudySession() (*LastStudySession, error) {
 	return &session, nil
 }
 
-func (s *DashboardService) GetStudyProgress() (*StudyProgress, error) {
+func (s *DashboardService) GetStudyProgress(language string) (*StudyProgress, error) {
+	s = s.labeled("GetStudyProgress")
 	query := `
 		SELECT 
-			COUNT(DISTINCT word_id) as studied,
-			(SELECT COUNT(*) FROM words) as total
-		FROM word_review_items
+			COUNT(DISTINCT wri.word_id) as studied,
+			(SELECT COUNT(*) FROM words WHERE (? = '' OR language = ?) AND deleted_at IS NULL) as total
+		FROM word_review_items wri
+		JOIN words w ON wri.word_id = w.id
+		WHERE (? = '' OR w.language = ?) AND wri.deleted_at IS NULL
 	`
 	
 	var progress StudyProgress
-	err := s.db.QueryRow(query).Scan(
+	err := s.db.QueryRow(query, language, language, language, language).Scan(
 		&progress.TotalWordsStudied,
 		&progress.TotalAvailableWords,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	levels, err := wordMastery(s.db, "(? = '' OR w.language = ?)", language, language)
+	if err != nil {
+		return nil, err
+	}
+	progress.Mastery = masteryDistribution(levels, progress.TotalAvailableWords)
+	progress.TotalWordsLearned = progress.Mastery.Young + progress.Mastery.Mature
 	return &progress, nil
 }
 
-func (s *DashboardService) GetQuickStats() (*QuickStats, error) {
-	// Get success rate and word counts
+func (s *DashboardService) GetQuickStats(language string) (*QuickStats, error) {
+	s = s.labeled("GetQuickStats")
+	// Get success rate
 	successRateQuery := `
 		SELECT 
-			CAST(COALESCE(CAST(SUM(CASE WHEN correct THEN 1 ELSE 0 END) AS REAL) / NULLIF(CAST(COUNT(*) AS REAL), 0) * 100, 0.0) AS REAL),
-			COALESCE(COUNT(DISTINCT CASE WHEN correct THEN word_id END), 0),
-			COALESCE(COUNT(DISTINCT CASE WHEN NOT correct THEN word_id END), 0)
-		FROM word_review_items
+			CAST(COALESCE(CAST(SUM(CASE WHEN wri.correct THEN 1 ELSE 0 END) AS REAL) / NULLIF(CAST(COUNT(*) AS REAL), 0) * 100, 0.0) AS REAL)
+		FROM word_review_items wri
+		JOIN words w ON wri.word_id = w.id
+		WHERE (? = '' OR w.language = ?) AND wri.deleted_at IS NULL
 	`
 	
 	// Get total study sessions
-	sessionsQuery := `SELECT COUNT(*) FROM study_sessions`
+	sessionsQuery := `
+		SELECT COUNT(*)
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		WHERE (? = '' OR g.language = ?)
+		AND ss.deleted_at IS NULL AND g.deleted_at IS NULL
+	`
 	
 	// Get total active groups
 	groupsQuery := `
-		SELECT COUNT(DISTINCT group_id) 
-		FROM study_sessions 
-		WHERE created_at >= datetime('now', '-30 days')
+		SELECT COUNT(DISTINCT ss.group_id) 
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		WHERE ss.created_at >= datetime('now', '-30 days')
+		AND (? = '' OR g.language = ?)
+		AND ss.deleted_at IS NULL AND g.deleted_at IS NULL
 	`
 	
-	// Get study streak (simplified version - counts consecutive days)
-	streakQuery := `
-		WITH RECURSIVE dates AS (
-			SELECT date(created_at) as study_date
-			FROM study_sessions
-			GROUP BY date(created_at)
-			ORDER BY study_date DESC
-		),
-		streak AS (
-			SELECT study_date, 1 as streak
-			FROM dates
-			WHERE study_date = date('now', '-1 day')
-			UNION ALL
-			SELECT d.study_date, s.streak + 1
-			FROM dates d
-			JOIN streak s ON date(d.study_date, '+1 day') = s.study_date
-		)
-		SELECT COALESCE(MAX(streak), 0) FROM streak
+	// Get study days for the streak, which is counted in the learner's timezone
+	studyTimesQuery := `
+		SELECT ss.created_at
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		WHERE (? = '' OR g.language = ?)
+		AND ss.deleted_at IS NULL AND g.deleted_at IS NULL
 	`
 	
 	var stats QuickStats
-	if err := s.db.QueryRow(successRateQuery).Scan(&stats.SuccessRate, &stats.WordsLearned, &stats.WordsInProgress); err != nil {
+	if err := s.db.QueryRow(successRateQuery, language, language).Scan(&stats.SuccessRate); err != nil {
 		return nil, err
 	}
-	if err := s.db.QueryRow(sessionsQuery).Scan(&stats.TotalStudySessions); err != nil {
+
+	// Learned words are young or mature, the rest of the reviewed words are in progress
+	levels, err := wordMastery(s.db, "(? = '' OR w.language = ?)", language, language)
+	if err != nil {
 		return nil, err
 	}
-	if err := s.db.QueryRow(groupsQuery).Scan(&stats.TotalActiveGroups); err != nil {
+	mastery := masteryDistribution(levels, len(levels))
+	stats.WordsLearned = mastery.Young + mastery.Mature
+	stats.WordsInProgress = mastery.Learning + mastery.Lapsed
+	if err := s.db.QueryRow(sessionsQuery, language, language).Scan(&stats.TotalStudySessions); err != nil {
 		return nil, err
 	}
-	if err := s.db.QueryRow(streakQuery).Scan(&stats.StudyStreakDays); err != nil {
+	if err := s.db.QueryRow(groupsQuery, language, language).Scan(&stats.TotalActiveGroups); err != nil {
 		return nil, err
 	}
+
+	location, err := loadUserLocation(s.db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(studyTimesQuery, language, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	studyDays := make(map[string]bool)
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		studyDays[createdAt.In(location).Format(dateLayout)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	stats.StudyStreakDays, stats.LongestStreakDays = studyStreaks(studyDays, time.Now().In(location))
 	
 	return &stats, nil
+}
+
+// studyStreaks returns the current and the longest run of consecutive study
+// days. The current streak includes today, and stays alive through today
+// when the learner studied yesterday but has not studied yet today.
+func studyStreaks(studyDays map[string]bool, today time.Time) (int, int) {
+	day := today
+	if !studyDays[day.Format(dateLayout)] {
+		day = day.AddDate(0, 0, -1)
+	}
+	current := 0
+	for studyDays[day.Format(dateLayout)] {
+		current++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	longest := 0
+	for date := range studyDays {
+		start, err := time.Parse(dateLayout, date)
+		if err != nil {
+			continue
+		}
+		// Only count runs from their first day
+		if studyDays[start.AddDate(0, 0, -1).Format(dateLayout)] {
+			continue
+		}
+		length := 0
+		for d := start; studyDays[d.Format(dateLayout)]; d = d.AddDate(0, 0, 1) {
+			length++
+		}
+		if length > longest {
+			longest = length
+		}
+	}
+
+	return current, longest
+}
+
+// GetGoalHistory returns review counts, study minutes and daily goal
+// completion for the last days local calendar days, oldest first.
+func (s *DashboardService) GetGoalHistory(days int) (*models.GoalHistoryResponse, error) {
+	s = s.labeled("GetGoalHistory")
+	location, err := loadUserLocation(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().In(location)
+	firstDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, location).AddDate(0, 0, -(days - 1))
+	since := firstDay.UTC().Format("2006-01-02 15:04:05")
+
+	reviews := make(map[string]int)
+	reviewRows, err := s.db.Query("SELECT created_at FROM word_review_items WHERE created_at >= ? AND deleted_at IS NULL", since)
+	if err != nil {
+		return nil, err
+	}
+	defer reviewRows.Close()
+	for reviewRows.Next() {
+		var createdAt time.Time
+		if err := reviewRows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		reviews[createdAt.In(location).Format(dateLayout)]++
+	}
+	if err := reviewRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A session lasts from its start until its last review
+	minutesQuery := `
+		SELECT ss.created_at, MAX(wri.created_at)
+		FROM study_sessions ss
+		LEFT JOIN word_review_items wri ON wri.study_session_id = ss.id AND wri.deleted_at IS NULL
+		WHERE ss.created_at >= ? AND ss.deleted_at IS NULL
+		GROUP BY ss.id
+	`
+	minutes := make(map[string]float64)
+	sessionRows, err := s.db.Query(minutesQuery, since)
+	if err != nil {
+		return nil, err
+	}
+	defer sessionRows.Close()
+	for sessionRows.Next() {
+		var startedAt time.Time
+		var lastReview sql.NullString
+		if err := sessionRows.Scan(&startedAt, &lastReview); err != nil {
+			return nil, err
+		}
+		if !lastReview.Valid {
+			continue
+		}
+		endedAt, err := parseTimestamp(lastReview.String)
+		if err != nil {
+			return nil, err
+		}
+		if endedAt.After(startedAt) {
+			minutes[startedAt.In(location).Format(dateLayout)] += endedAt.Sub(startedAt).Minutes()
+		}
+	}
+	if err := sessionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	response := &models.GoalHistoryResponse{
+		Timezone: location.String(),
+		Items:    make([]models.DailyGoalProgress, 0, days),
+	}
+	for day := firstDay; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		goal, err := goalOn(s.db, date)
+		if err != nil {
+			return nil, err
+		}
+
+		progress := models.DailyGoalProgress{
+			Date:    date,
+			Reviews: reviews[date],
+			Minutes: math.Round(minutes[date]*10) / 10,
+			Goal:    goal,
+		}
+		if goal != nil {
+			switch goal.GoalType {
+			case GoalTypeReviews:
+				progress.Completed = progress.Reviews >= goal.Target
+			case GoalTypeMinutes:
+				progress.Completed = progress.Minutes >= float64(goal.Target)
+			}
+		}
+		if progress.Completed {
+			response.CompletedDays++
+		}
+		response.Items = append(response.Items, progress)
+	}
+
+	// Today does not break the goal streak until it is over
+	for i := len(response.Items) - 1; i >= 0; i-- {
+		if response.Items[i].Completed {
+			response.GoalStreakDays++
+		} else if i != len(response.Items)-1 {
+			break
+		}
+	}
+
+	if len(response.Items) > 0 {
+		response.CurrentGoal = response.Items[len(response.Items)-1].Goal
+	}
+
+	return response, nil
+}
+
+// parseTimestamp parses a timestamp returned by SQLite as text, which happens
+// for aggregates such as MAX(created_at) that lose the column's DATETIME type.
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05.999999999-07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse timestamp %q", value)
 }
\ No newline at end of file
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func TestStudyStreaks(t *testing.T) {
+	today := time.Date(2025, 2, 10, 9, 0, 0, 0, time.UTC)
+	days := func(dates ...string) map[string]bool {
+		set := make(map[string]bool)
+		for _, date := range dates {
+			set[date] = true
+		}
+		return set
+	}
+
+	tests := []struct {
+		name             string
+		studyDays        map[string]bool
+		current, longest int
+	}{
+		{"no study", days(), 0, 0},
+		{"studied today only", days("2025-02-10"), 1, 1},
+		{"studied yesterday but not yet today", days("2025-02-08", "2025-02-09"), 2, 2},
+		{"streak broken", days("2025-02-05", "2025-02-06", "2025-02-07", "2025-02-10"), 1, 3},
+		{"today extends streak", days("2025-02-08", "2025-02-09", "2025-02-10"), 3, 3},
+	}
+	for _, tt := range tests {
+		current, longest := studyStreaks(tt.studyDays, today)
+		if current != tt.current || longest != tt.longest {
+			t.Errorf("%s: got current %d, longest %d; want %d, %d", tt.name, current, longest, tt.current, tt.longest)
+		}
+	}
+}
+
+func TestGoalHistory(t *testing.T) {
+	db := testdb.New(t)
+	settings := NewSettingsService(db)
+	dashboard := NewDashboardService(db)
+
+	if _, err := settings.UpdateSettings(nil, &models.DailyGoal{GoalType: GoalTypeReviews, Target: 2}, nil); err != nil {
+		t.Fatalf("Failed to set goal: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES (2, 1, datetime('now', '-5 minutes'), 1);
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(1, 2, 1, datetime('now', '-4 minutes')),
+		(2, 2, 0, datetime('now'));
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+
+	history, err := dashboard.GetGoalHistory(7)
+	if err != nil {
+		t.Fatalf("Failed to get goal history: %v", err)
+	}
+	if len(history.Items) != 7 {
+		t.Fatalf("Expected 7 days; got %d", len(history.Items))
+	}
+
+	today := history.Items[6]
+	if today.Reviews != 2 || !today.Completed {
+		t.Errorf("Expected today's review goal to be completed; got %+v", today)
+	}
+	if today.Minutes < 4.9 || today.Minutes > 5.1 {
+		t.Errorf("Expected about 5 minutes studied; got %v", today.Minutes)
+	}
+	if history.Items[0].Goal != nil {
+		t.Errorf("Expected no goal before it was set; got %+v", history.Items[0].Goal)
+	}
+	if history.GoalStreakDays != 1 {
+		t.Errorf("Expected a goal streak of 1; got %d", history.GoalStreakDays)
+	}
+}
+
+func TestUpdateSettingsValidation(t *testing.T) {
+	settings := NewSettingsService(testdb.New(t))
+
+	invalid := "Mars/Base"
+	if _, err := settings.UpdateSettings(&invalid, nil, nil); err == nil {
+		t.Errorf("Expected an error for an unknown timezone")
+	}
+	if _, err := settings.UpdateSettings(nil, &models.DailyGoal{GoalType: "pages", Target: 1}, nil); err == nil {
+		t.Errorf("Expected an error for an unknown goal type")
+	}
+
+	tokyo := "Asia/Tokyo"
+	updated, err := settings.UpdateSettings(&tokyo, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to update timezone: %v", err)
+	}
+	if updated.Timezone != tokyo || updated.DailyGoal != nil {
+		t.Errorf("Expected timezone %s without a goal; got %+v", tokyo, updated)
+	}
+}
+
+func TestActivity(t *testing.T) {
+	db := testdb.New(t)
+	dashboard := NewDashboardService(db)
+
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES
+		(2, 1, '2025-02-03 10:00:00', 1),
+		(3, 1, '2025-02-12 10:00:00', 1);
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(1, 2, 1, '2025-02-03 10:01:00'),
+		(2, 2, 0, '2025-02-03 10:02:00'),
+		(1, 3, 1, '2025-02-12 10:01:00'),
+		(3, 3, 1, '2025-02-12 10:02:00');
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+
+	weekly, err := dashboard.GetActivity("2025-02-04", "2025-02-16", BucketWeek, "")
+	if err != nil {
+		t.Fatalf("Failed to get weekly activity: %v", err)
+	}
+	want := []models.ActivityBucket{
+		{Start: "2025-02-03", End: "2025-02-09", Reviews: 2, CorrectCount: 1, Accuracy: 50, Sessions: 1, NewWords: 2},
+		{Start: "2025-02-10", End: "2025-02-16", Reviews: 2, CorrectCount: 2, Accuracy: 100, Sessions: 1, NewWords: 1},
+	}
+	if len(weekly.Items) != len(want) {
+		t.Fatalf("Expected %d weeks; got %+v", len(want), weekly.Items)
+	}
+	for i := range want {
+		if weekly.Items[i] != want[i] {
+			t.Errorf("Week %d: got %+v; want %+v", i, weekly.Items[i], want[i])
+		}
+	}
+
+	daily, err := dashboard.GetActivity("2025-02-01", "2025-02-28", BucketDay, "")
+	if err != nil {
+		t.Fatalf("Failed to get daily activity: %v", err)
+	}
+	if len(daily.Items) != 28 {
+		t.Fatalf("Expected 28 days; got %d", len(daily.Items))
+	}
+	if empty := daily.Items[0]; empty.Start != "2025-02-01" || empty.Reviews != 0 || empty.Accuracy != 0 {
+		t.Errorf("Expected an empty first day; got %+v", empty)
+	}
+
+	if _, err := dashboard.GetActivity("2025-02-10", "2025-02-01", BucketDay, ""); err == nil {
+		t.Error("Expected an error for a reversed range")
+	}
+	if _, err := dashboard.GetActivity("", "", "year", ""); err == nil {
+		t.Error("Expected an error for an unknown bucket")
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func TestDataVersion(t *testing.T) {
+	db := testdb.New(t)
+	groups := NewGroupsService(db)
+	sessions := NewStudySessionsService(db, nil)
+
+	version, _ := db.DataVersion()
+	expectVersion := func(name string, changed bool) {
+		t.Helper()
+		next, _ := db.DataVersion()
+		if (next != version) != changed {
+			t.Errorf("%s: data version went from %d to %d", name, version, next)
+		}
+		version = next
+	}
+
+	if _, err := groups.GetGroups(1, ""); err != nil {
+		t.Fatalf("Failed to get groups: %v", err)
+	}
+	expectVersion("GetGroups", false)
+
+	if err := sessions.ReviewWord(1, 1, true); err != nil {
+		t.Fatalf("Failed to review word: %v", err)
+	}
+	expectVersion("ReviewWord", true)
+
+	// Inserts that return rows run through QueryRow
+	rules := []models.GroupRule{{Type: RuleNotReviewedInDays, Value: 7}}
+	if _, err := groups.CreateSmartGroup("Stale", models.LanguageJapanese, rules); err != nil {
+		t.Fatalf("Failed to create smart group: %v", err)
+	}
+	expectVersion("CreateSmartGroup", true)
+
+	// Writes are found behind a WITH clause or a comment too
+	for _, query := range []string{
+		`WITH named AS (SELECT 'Verbs' AS name) INSERT INTO groups (name) SELECT name FROM named RETURNING id`,
+		`-- rename
+		UPDATE groups SET name = 'Nouns' WHERE name = 'Verbs' RETURNING id`,
+	} {
+		var id int
+		if err := db.QueryRow(query).Scan(&id); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		expectVersion(query, true)
+	}
+}
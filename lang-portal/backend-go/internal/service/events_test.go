@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/testdb"
+)
+
+func TestReviewWordPublishesEvent(t *testing.T) {
+	db := testdb.New(t)
+	subscription, _, _ := events.Default.Subscribe(0, events.ForUser("alice"))
+	defer subscription.Cancel()
+
+	ctx := events.NewUserContext(context.Background(), "alice")
+	sessions := NewStudySessionsService(db, nil).WithContext(ctx)
+	if err := sessions.ReviewWord(1, 2, false); err != nil {
+		t.Fatalf("Failed to review word: %v", err)
+	}
+
+	e := <-subscription.C
+	data, _ := e.Data.(map[string]interface{})
+	if e.Type != events.ReviewRecorded || e.User != "alice" || data["word_id"] != 2 || data["correct"] != false {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestReviewWordSurvivesTroubleWordsFailure(t *testing.T) {
+	db := testdb.New(t)
+	// Without the settings the trouble words cannot be refreshed
+	if _, err := db.Exec("DROP TABLE user_settings"); err != nil {
+		t.Fatalf("Failed to drop settings: %v", err)
+	}
+	subscription, _, _ := events.Default.Subscribe(0, events.ForUser("bob"))
+	defer subscription.Cancel()
+
+	ctx := events.NewUserContext(context.Background(), "bob")
+	if err := NewStudySessionsService(db, nil).WithContext(ctx).ReviewWord(1, 2, true); err != nil {
+		t.Fatalf("Expected the review to be recorded; got %v", err)
+	}
+	if e := <-subscription.C; e.Type != events.ReviewRecorded {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestReviewsCoveringGroupCompleteSession(t *testing.T) {
+	db := testdb.New(t)
+	subscription, _, _ := events.Default.Subscribe(0, func(e events.Event) bool { return e.Type == events.SessionCompleted })
+	defer subscription.Cancel()
+
+	// Session 1 studies the Animals, words 1 to 4
+	sessions := NewStudySessionsService(db, nil)
+	for _, review := range []struct {
+		wordID  int
+		correct bool
+	}{{1, true}, {2, false}, {2, true}, {3, true}, {5, false}} {
+		if err := sessions.ReviewWord(1, review.wordID, review.correct); err != nil {
+			t.Fatalf("Failed to review word %d: %v", review.wordID, err)
+		}
+	}
+	select {
+	case e := <-subscription.C:
+		t.Fatalf("Expected the session to go on until word 4 is reviewed; got %+v", e)
+	default:
+	}
+
+	if err := sessions.ReviewWord(1, 4, true); err != nil {
+		t.Fatalf("Failed to review word 4: %v", err)
+	}
+	e := <-subscription.C
+	if data := e.Data.(map[string]interface{}); data["study_session_id"] != 1 || data["correct_count"] != 4 || data["total_count"] != 6 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	// Reviewing a word again does not complete the session twice
+	if err := sessions.ReviewWord(1, 1, false); err != nil {
+		t.Fatalf("Failed to review word 1: %v", err)
+	}
+	select {
+	case e := <-subscription.C:
+		t.Errorf("Expected the session to complete once; got %+v", e)
+	default:
+	}
+}
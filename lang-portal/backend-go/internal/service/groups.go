@@ -1,7 +1,11 @@
 package service
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+
+	"lang-portal/internal/events"
 	"lang-portal/internal/models"
 )
 
@@ -13,13 +17,28 @@ func NewGroupsService(db *models.DB) *GroupsService {
 	return &GroupsService{db: db}
 }
 
-func (s *GroupsService) GetGroups(page int) (*models.GroupsResponse, error) {
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *GroupsService) WithContext(ctx context.Context) *GroupsService {
+	return &GroupsService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *GroupsService) labeled(method string) *GroupsService {
+	c := *s
+	c.db = s.db.Labeled("GroupsService." + method)
+	return &c
+}
+
+// GetGroups lists groups with their word counts. An empty language lists groups of every language.
+func (s *GroupsService) GetGroups(page int, language string) (*models.GroupsResponse, error) {
+	s = s.labeled("GetGroups")
 	itemsPerPage := 100
 	offset := (page - 1) * itemsPerPage
 
 	// Get total count
 	var totalItems int
-	if err := s.db.QueryRow("SELECT COUNT(*) FROM groups").Scan(&totalItems); err != nil {
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM groups WHERE (? = '' OR language = ?) AND deleted_at IS NULL", language, language).Scan(&totalItems); err != nil {
 		return nil, err
 	}
 
@@ -28,13 +47,18 @@ func (s *GroupsService) GetGroups(page int) (*models.GroupsResponse, error) {
 		SELECT 
 			g.id,
 			g.name,
-			(SELECT COUNT(*) FROM words_groups WHERE group_id = g.id) as total_word_count
+			g.language,
+			g.kind,
+			g.rules,
+			(SELECT COUNT(*) FROM words_groups wg JOIN words w ON w.id = wg.word_id
+				WHERE wg.group_id = g.id AND w.deleted_at IS NULL) as total_word_count
 		FROM groups g
+		WHERE (? = '' OR g.language = ?) AND g.deleted_at IS NULL
 		ORDER BY g.name
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := s.db.Query(query, itemsPerPage, offset)
+	rows, err := s.db.Query(query, language, language, itemsPerPage, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -43,11 +67,27 @@ func (s *GroupsService) GetGroups(page int) (*models.GroupsResponse, error) {
 	groups := make([]models.GroupWithStats, 0)
 	for rows.Next() {
 		var group models.GroupWithStats
-		if err := rows.Scan(&group.ID, &group.Name, &group.Stats.TotalWordCount); err != nil {
+		var rules sql.NullString
+		if err := rows.Scan(&group.ID, &group.Name, &group.Language, &group.Kind, &rules, &group.Stats.TotalWordCount); err != nil {
+			return nil, err
+		}
+		if group.Rules, err = groupRules(group.Kind, rules); err != nil {
 			return nil, err
 		}
 		groups = append(groups, group)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Smart groups have no words_groups rows, their words are counted by rule
+	for i := range groups {
+		if groups[i].Kind == GroupKindSmart {
+			if groups[i].Stats.TotalWordCount, err = countGroupWords(s.db, groups[i].ID); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	response := &models.GroupsResponse{
 		Items: groups,
@@ -68,9 +108,10 @@ func (s *GroupsService) GetGroups(page int) (*models.GroupsResponse, error) {
 }
 
 func (s *GroupsService) GetGroup(id int) (*models.GroupWithStats, error) {
+	s = s.labeled("GetGroup")
 	// First check if group exists
 	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM groups WHERE id = ?)`
+	checkQuery := `SELECT EXISTS(SELECT 1 FROM groups WHERE id = ? AND deleted_at IS NULL)`
 	if err := s.db.QueryRow(checkQuery, id).Scan(&exists); err != nil {
 		return nil, err
 	}
@@ -82,27 +123,51 @@ func (s *GroupsService) GetGroup(id int) (*models.GroupWithStats, error) {
 		SELECT 
 			g.id,
 			g.name,
-			(SELECT COUNT(*) FROM words_groups WHERE group_id = g.id) as total_word_count
+			g.language,
+			g.kind,
+			g.rules
 		FROM groups g
 		WHERE g.id = ?
 	`
 
 	var group models.GroupWithStats
+	var rules sql.NullString
 	if err := s.db.QueryRow(query, id).Scan(
 		&group.ID,
 		&group.Name,
-		&group.Stats.TotalWordCount,
+		&group.Language,
+		&group.Kind,
+		&rules,
 	); err != nil {
 		return nil, err
 	}
+	var err error
+	if group.Rules, err = groupRules(group.Kind, rules); err != nil {
+		return nil, err
+	}
+	if group.Stats.TotalWordCount, err = countGroupWords(s.db, id); err != nil {
+		return nil, err
+	}
+
+	condition, args, err := groupWordsCondition(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := wordMastery(s.db, condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	distribution := masteryDistribution(levels, group.Stats.TotalWordCount)
+	group.Mastery = &distribution
 
 	return &group, nil
 }
 
 func (s *GroupsService) GetGroupWords(groupID, page int) (*models.WordsResponse, error) {
+	s = s.labeled("GetGroupWords")
 	// First check if group exists
 	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM groups WHERE id = ?)`
+	checkQuery := `SELECT EXISTS(SELECT 1 FROM groups WHERE id = ? AND deleted_at IS NULL)`
 	if err := s.db.QueryRow(checkQuery, groupID).Scan(&exists); err != nil {
 		return nil, err
 	}
@@ -113,36 +178,38 @@ func (s *GroupsService) GetGroupWords(groupID, page int) (*models.WordsResponse,
 	itemsPerPage := 100
 	offset := (page - 1) * itemsPerPage
 
+	// Smart groups select their words by rule, other groups by membership
+	condition, args, err := groupWordsCondition(s.db, groupID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get total count
 	var totalItems int
-	countQuery := `
-		SELECT COUNT(*)
-		FROM words_groups wg
-		JOIN words w ON wg.word_id = w.id
-		WHERE wg.group_id = ?
-	`
-	if err := s.db.QueryRow(countQuery, groupID).Scan(&totalItems); err != nil {
+	countQuery := `SELECT COUNT(*) FROM words w WHERE ` + condition
+	if err := s.db.QueryRow(countQuery, args...).Scan(&totalItems); err != nil {
 		return nil, err
 	}
 
 	// Get words with stats
 	query := `
 		SELECT 
-			w.japanese,
-			w.romaji,
-			w.english,
+			w.id,
+			w.language,
+			w.term,
+			w.transliteration,
+			w.meaning,
 			(SELECT COUNT(*) FROM word_review_items wri 
-				WHERE wri.word_id = w.id AND wri.correct = 1) as correct_count,
+				WHERE wri.word_id = w.id AND wri.correct = 1 AND wri.deleted_at IS NULL) as correct_count,
 			(SELECT COUNT(*) FROM word_review_items wri 
-				WHERE wri.word_id = w.id AND wri.correct = 0) as wrong_count
-		FROM words_groups wg
-		JOIN words w ON wg.word_id = w.id
-		WHERE wg.group_id = ?
-		ORDER BY w.japanese
+				WHERE wri.word_id = w.id AND wri.correct = 0 AND wri.deleted_at IS NULL) as wrong_count
+		FROM words w
+		WHERE ` + condition + `
+		ORDER BY w.term
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := s.db.Query(query, groupID, itemsPerPage, offset)
+	rows, err := s.db.Query(query, append(args, itemsPerPage, offset)...)
 	if err != nil {
 		return nil, err
 	}
@@ -152,17 +219,24 @@ func (s *GroupsService) GetGroupWords(groupID, page int) (*models.WordsResponse,
 	for rows.Next() {
 		var word models.WordWithStats
 		if err := rows.Scan(
-			&word.Japanese,
-			&word.Romaji,
-			&word.English,
+			&word.ID,
+			&word.Language,
+			&word.Term,
+			&word.Transliteration,
+			&word.Meaning,
 			&word.CorrectCount,
 			&word.WrongCount,
 		); err != nil {
 			return nil, err
 		}
+		word.LegacyWordFields = models.NewLegacyWordFields(word.Language, word.Term, word.Transliteration, word.Meaning)
 		words = append(words, word)
 	}
 
+	if err := fillWordDetails(s.db, words); err != nil {
+		return nil, err
+	}
+
 	response := &models.WordsResponse{
 		Items: words,
 		Pagination: &models.Pagination{
@@ -182,6 +256,7 @@ func (s *GroupsService) GetGroupWords(groupID, page int) (*models.WordsResponse,
 }
 
 func (s *GroupsService) GetGroupStudySessions(groupID, page int) ([]models.StudySessionResponse, *models.Pagination, error) {
+	s = s.labeled("GetGroupStudySessions")
 	itemsPerPage := 100
 	offset := (page - 1) * itemsPerPage
 
@@ -190,7 +265,7 @@ func (s *GroupsService) GetGroupStudySessions(groupID, page int) ([]models.Study
 	countQuery := `
 		SELECT COUNT(*)
 		FROM study_sessions ss
-		WHERE ss.group_id = ?
+		WHERE ss.group_id = ? AND ss.deleted_at IS NULL
 	`
 	if err := s.db.QueryRow(countQuery, groupID).Scan(&totalItems); err != nil {
 		return nil, nil, err
@@ -204,11 +279,11 @@ func (s *GroupsService) GetGroupStudySessions(groupID, page int) ([]models.Study
 			g.name as group_name,
 			ss.created_at as start_time,
 			DATETIME(ss.created_at, '+10 minutes') as end_time,
-			(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id) as review_items_count
+			(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id AND deleted_at IS NULL) as review_items_count
 		FROM study_sessions ss
 		JOIN groups g ON ss.group_id = g.id
 		JOIN study_activities sa ON ss.study_activity_id = sa.id
-		WHERE ss.group_id = ?
+		WHERE ss.group_id = ? AND ss.deleted_at IS NULL
 		ORDER BY ss.created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -243,4 +318,39 @@ func (s *GroupsService) GetGroupStudySessions(groupID, page int) ([]models.Study
 	}
 
 	return sessions, pagination, nil
-}
\ No newline at end of file
+}
+
+// DeleteGroup moves a group to the trash. Trouble words groups are kept by
+// the server, and groups with study sessions keep their history, so neither
+// can be deleted.
+func (s *GroupsService) DeleteGroup(id int) error {
+	s = s.labeled("DeleteGroup")
+	var kind string
+	if err := s.db.QueryRow("SELECT kind FROM groups WHERE id = ? AND deleted_at IS NULL", id).Scan(&kind); err != nil {
+		return err
+	}
+	if kind == GroupKindLeeches {
+		return fmt.Errorf("group %d holds trouble words and cannot be deleted", id)
+	}
+
+	var studied bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_sessions WHERE group_id = ? AND deleted_at IS NULL)", id).Scan(&studied); err != nil {
+		return err
+	}
+	if studied {
+		return fmt.Errorf("group %d has study sessions and cannot be deleted", id)
+	}
+
+	// A concurrent delete may have come first; only one of them deletes
+	result, err := s.db.Exec("UPDATE groups SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	events.PublishShared(events.GroupDeleted, map[string]interface{}{"id": id})
+	return nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"lang-portal/internal/logging"
+	"lang-portal/internal/models"
+)
+
+const (
+	GroupKindStatic  = "static"
+	GroupKindLeeches = "leeches"
+)
+
+// troubleWordsGroupName returns the name of the leech group of a language.
+// Group names are unique, so languages other than Japanese get a suffix.
+func troubleWordsGroupName(language string) string {
+	if language == models.LanguageJapanese {
+		return "Trouble words"
+	}
+	return "Trouble words (" + language + ")"
+}
+
+type LeechService struct {
+	db *models.DB
+}
+
+func NewLeechService(db *models.DB) *LeechService {
+	return &LeechService{db: db}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *LeechService) WithContext(ctx context.Context) *LeechService {
+	return &LeechService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *LeechService) labeled(method string) *LeechService {
+	c := *s
+	c.db = s.db.Labeled("LeechService." + method)
+	return &c
+}
+
+// leechCounts returns the number of wrong answers and of lapses in a review
+// history. A lapse is a wrong answer given while the word was young or mature.
+func leechCounts(reviews []reviewOutcome) (int, int) {
+	failures, lapses, streak := 0, 0, 0
+	for _, review := range reviews {
+		if review.correct {
+			streak++
+			continue
+		}
+		failures++
+		if streak >= youngStreak {
+			lapses++
+		}
+		streak = 0
+	}
+	return failures, lapses
+}
+
+// isLeech reports whether a word keeps being failed. Words stop being leeches
+// once they are learned again.
+func isLeech(reviews []reviewOutcome, thresholds models.LeechThresholds) bool {
+	if level := masteryLevel(reviews); level == MasteryYoung || level == MasteryMature {
+		return false
+	}
+	failures, lapses := leechCounts(reviews)
+	return failures >= thresholds.Failures || lapses >= thresholds.Lapses
+}
+
+// GetLeeches lists the current leeches, most failed first, with their failures
+func (s *LeechService) GetLeeches(language string, page int) ([]models.Leech, *models.Pagination, error) {
+	s = s.labeled("GetLeeches")
+	thresholds, err := loadLeechThresholds(s.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := reviewHistory(s.db, "(? = '' OR w.language = ?)", language, language)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leeches := make([]models.Leech, 0)
+	for wordID, reviews := range history {
+		if !isLeech(reviews, thresholds) {
+			continue
+		}
+		leech := models.Leech{WordID: wordID, Mastery: masteryLevel(reviews)}
+		leech.WrongCount, leech.Lapses = leechCounts(reviews)
+		leech.CorrectCount = len(reviews) - leech.WrongCount
+		leeches = append(leeches, leech)
+	}
+	sort.Slice(leeches, func(i, j int) bool {
+		if leeches[i].WrongCount != leeches[j].WrongCount {
+			return leeches[i].WrongCount > leeches[j].WrongCount
+		}
+		if leeches[i].Lapses != leeches[j].Lapses {
+			return leeches[i].Lapses > leeches[j].Lapses
+		}
+		return leeches[i].WordID < leeches[j].WordID
+	})
+
+	itemsPerPage := 100
+	totalItems := len(leeches)
+	pagination := &models.Pagination{
+		CurrentPage:  page,
+		TotalPages:   (totalItems + itemsPerPage - 1) / itemsPerPage,
+		TotalItems:   totalItems,
+		ItemsPerPage: itemsPerPage,
+	}
+
+	offset := (page - 1) * itemsPerPage
+	if offset >= totalItems {
+		return make([]models.Leech, 0), pagination, nil
+	}
+	leeches = leeches[offset:min(offset+itemsPerPage, totalItems)]
+
+	if err := s.loadLeechDetails(leeches); err != nil {
+		return nil, nil, err
+	}
+	return leeches, pagination, nil
+}
+
+// loadLeechDetails fills in the words and the failure history of leeches
+func (s *LeechService) loadLeechDetails(leeches []models.Leech) error {
+	index := make(map[int]*models.Leech, len(leeches))
+	ids := make([]int, len(leeches))
+	for i := range leeches {
+		leeches[i].Failures = make([]models.LeechFailure, 0)
+		index[leeches[i].WordID] = &leeches[i]
+		ids[i] = leeches[i].WordID
+	}
+	placeholders, args := idPlaceholders(ids)
+
+	wordRows, err := s.db.Query(`
+		SELECT id, language, term, transliteration, meaning
+		FROM words
+		WHERE id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer wordRows.Close()
+	for wordRows.Next() {
+		var id int
+		var word models.Word
+		if err := wordRows.Scan(&id, &word.Language, &word.Term, &word.Transliteration, &word.Meaning); err != nil {
+			return err
+		}
+		leech := index[id]
+		leech.Language = word.Language
+		leech.Term = word.Term
+		leech.Transliteration = word.Transliteration
+		leech.Meaning = word.Meaning
+		leech.LegacyWordFields = models.NewLegacyWordFields(word.Language, word.Term, word.Transliteration, word.Meaning)
+	}
+	if err := wordRows.Err(); err != nil {
+		return err
+	}
+
+	failureRows, err := s.db.Query(`
+		SELECT word_id, study_session_id, created_at
+		FROM word_review_items
+		WHERE correct = 0 AND deleted_at IS NULL AND word_id IN (`+placeholders+`)
+		ORDER BY created_at DESC, rowid DESC
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer failureRows.Close()
+	for failureRows.Next() {
+		var wordID int
+		var failure models.LeechFailure
+		if err := failureRows.Scan(&wordID, &failure.StudySessionID, &failure.CreatedAt); err != nil {
+			return err
+		}
+		leech := index[wordID]
+		if leech.LastFailedAt == nil {
+			failedAt := failure.CreatedAt
+			leech.LastFailedAt = &failedAt
+		}
+		leech.Failures = append(leech.Failures, failure)
+	}
+	return failureRows.Err()
+}
+
+// loadLeechThresholds returns the learner's leech thresholds
+func loadLeechThresholds(db *models.DB) (models.LeechThresholds, error) {
+	var thresholds models.LeechThresholds
+	err := db.QueryRow(
+		"SELECT leech_failure_threshold, leech_lapse_threshold FROM user_settings WHERE id = 1",
+	).Scan(&thresholds.Failures, &thresholds.Lapses)
+	if err == sql.ErrNoRows {
+		return models.LeechThresholds{Failures: 8, Lapses: 3}, nil
+	}
+	return thresholds, err
+}
+
+// refreshTroubleWordsAfter refreshes the trouble words once the change that
+// affects them has been committed. The change stands when the refresh fails,
+// so the error is logged rather than returned; the next refresh of the words
+// puts them right.
+func refreshTroubleWordsAfter(db *models.DB, condition string, args ...interface{}) {
+	if err := refreshTroubleWords(db, condition, args...); err != nil {
+		logging.FromContext(db.Context()).Error("failed to refresh trouble words", "error", err)
+	}
+}
+
+// refreshTroubleWords updates the membership of the "Trouble words" groups
+// for the words matching condition, which may refer to the words as w. It
+// creates the group of a language when its first leech shows up.
+func refreshTroubleWords(db *models.DB, condition string, args ...interface{}) error {
+	thresholds, err := loadLeechThresholds(db)
+	if err != nil {
+		return err
+	}
+	history, err := reviewHistory(db, condition, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT w.id, w.language FROM words w WHERE "+condition, args...)
+	if err != nil {
+		return err
+	}
+	leechLanguages := make(map[int]string)
+	for rows.Next() {
+		var wordID int
+		var language string
+		if err := rows.Scan(&wordID, &language); err != nil {
+			rows.Close()
+			return err
+		}
+		if isLeech(history[wordID], thresholds) {
+			leechLanguages[wordID] = language
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM words_groups
+		WHERE group_id IN (SELECT id FROM groups WHERE kind = ?)
+		AND word_id IN (SELECT w.id FROM words w WHERE `+condition+`)
+	`, append([]interface{}{GroupKindLeeches}, args...)...); err != nil {
+		return err
+	}
+
+	groupIDs := make(map[string]int)
+	for wordID, language := range leechLanguages {
+		groupID, ok := groupIDs[language]
+		if !ok {
+			if groupID, err = troubleWordsGroup(tx, language); err != nil {
+				return err
+			}
+			groupIDs[language] = groupID
+		}
+		if _, err := tx.Exec("INSERT INTO words_groups (word_id, group_id) VALUES (?, ?)", wordID, groupID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// troubleWordsGroup returns the ID of the leech group of a language, creating it if needed
+func troubleWordsGroup(tx *models.Tx, language string) (int, error) {
+	var id int
+	err := tx.QueryRow("SELECT id FROM groups WHERE kind = ? AND language = ? ORDER BY id LIMIT 1", GroupKindLeeches, language).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(
+			"INSERT INTO groups (name, language, kind) VALUES (?, ?, ?) RETURNING id",
+			troubleWordsGroupName(language), language, GroupKindLeeches,
+		).Scan(&id)
+	}
+	return id, err
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func TestLeechCounts(t *testing.T) {
+	var reviews []reviewOutcome
+	for _, answer := range "-+++-++++--" {
+		reviews = append(reviews, reviewOutcome{correct: answer == '+'})
+	}
+	failures, lapses := leechCounts(reviews)
+	if failures != 4 || lapses != 2 {
+		t.Errorf("Got %d failures and %d lapses; want 4 and 2", failures, lapses)
+	}
+}
+
+func TestTroubleWords(t *testing.T) {
+	db := testdb.New(t)
+	sessions := NewStudySessionsService(db, nil)
+	leeches := NewLeechService(db)
+
+	if _, err := NewSettingsService(db).UpdateSettings(nil, nil, &models.LeechThresholds{Failures: 2, Lapses: 3}); err != nil {
+		t.Fatalf("Failed to set leech thresholds: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, study_activity_id) VALUES
+		(2, 1, 1), (3, 1, 1), (4, 1, 1), (5, 1, 1), (6, 1, 1);
+	`); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	review := func(sessionID, wordID int, correct bool) {
+		t.Helper()
+		if err := sessions.ReviewWord(sessionID, wordID, correct); err != nil {
+			t.Fatalf("Failed to review word %d: %v", wordID, err)
+		}
+	}
+	troubleWords := func() []models.WordWithStats {
+		t.Helper()
+		var groupID int
+		if err := db.QueryRow("SELECT id FROM groups WHERE kind = ?", GroupKindLeeches).Scan(&groupID); err != nil {
+			t.Fatalf("Failed to find trouble words group: %v", err)
+		}
+		words, err := NewGroupsService(db).GetGroupWords(groupID, 1)
+		if err != nil {
+			t.Fatalf("Failed to get trouble words: %v", err)
+		}
+		return words.Items
+	}
+
+	review(2, 2, false)
+	review(2, 1, false)
+	review(3, 2, false)
+
+	items, pagination, err := leeches.GetLeeches("", 1)
+	if err != nil {
+		t.Fatalf("Failed to get leeches: %v", err)
+	}
+	if pagination.TotalItems != 1 || items[0].WordID != 2 || items[0].WrongCount != 2 {
+		t.Fatalf("Expected word 2 to be the only leech; got %+v", items)
+	}
+	if len(items[0].Failures) != 2 || items[0].LastFailedAt == nil {
+		t.Errorf("Expected the failure history of word 2; got %+v", items[0])
+	}
+	if words := troubleWords(); len(words) != 1 || words[0].Term != "猫" {
+		t.Errorf("Expected 猫 in the trouble words group; got %+v", words)
+	}
+
+	// Learning the word again takes it out of the group
+	review(4, 2, true)
+	review(5, 2, true)
+	review(6, 2, true)
+	if words := troubleWords(); len(words) != 0 {
+		t.Errorf("Expected no trouble words after relearning; got %+v", words)
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"lang-portal/internal/models"
+)
+
+// Mastery levels of a word, derived from its review history
+const (
+	MasteryNew      = "new"
+	MasteryLearning = "learning"
+	MasteryYoung    = "young"
+	MasteryMature   = "mature"
+	MasteryLapsed   = "lapsed"
+)
+
+const (
+	// youngStreak is the number of correct answers in a row that makes a word young
+	youngStreak = 3
+	// matureAge is how long a correct streak has to have lasted for a word to be mature
+	matureAge = 21 * 24 * time.Hour
+)
+
+type reviewOutcome struct {
+	correct bool
+	at      time.Time
+}
+
+// masteryLevel classifies a word from its reviews, oldest first. A word is
+// learning until it is answered correctly youngStreak times in a row, and
+// mature once that streak has lasted matureAge. A wrong answer after the
+// word was young or mature makes it lapsed until it is answered correctly.
+func masteryLevel(reviews []reviewOutcome) string {
+	if len(reviews) == 0 {
+		return MasteryNew
+	}
+
+	streak, streakStart, reachedYoung := 0, 0, false
+	for i, review := range reviews {
+		if !review.correct {
+			streak = 0
+			continue
+		}
+		if streak == 0 {
+			streakStart = i
+		}
+		streak++
+		if streak >= youngStreak {
+			reachedYoung = true
+		}
+	}
+
+	last := reviews[len(reviews)-1]
+	switch {
+	case !last.correct && reachedYoung:
+		return MasteryLapsed
+	case streak < youngStreak:
+		return MasteryLearning
+	case last.at.Sub(reviews[streakStart].at) >= matureAge:
+		return MasteryMature
+	default:
+		return MasteryYoung
+	}
+}
+
+// wordMastery returns the mastery level of every reviewed word matching
+// condition, keyed by word ID. The condition may refer to the reviews as wri
+// and to the words as w. Words without reviews are left out and are new.
+func wordMastery(db *models.DB, condition string, args ...interface{}) (map[int]string, error) {
+	history, err := reviewHistory(db, condition, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := make(map[int]string, len(history))
+	for wordID, reviews := range history {
+		levels[wordID] = masteryLevel(reviews)
+	}
+	return levels, nil
+}
+
+// reviewHistory returns the reviews matching condition, oldest first, keyed
+// by word ID. Deleted reviews and words are left out.
+func reviewHistory(db *models.DB, condition string, args ...interface{}) (map[int][]reviewOutcome, error) {
+	query := `
+		SELECT wri.word_id, wri.correct, wri.created_at
+		FROM word_review_items wri
+		JOIN words w ON wri.word_id = w.id
+		WHERE (` + condition + `) AND wri.deleted_at IS NULL AND w.deleted_at IS NULL
+		ORDER BY wri.word_id, wri.created_at, wri.rowid
+	`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make(map[int][]reviewOutcome)
+	for rows.Next() {
+		var wordID int
+		var review reviewOutcome
+		if err := rows.Scan(&wordID, &review.correct, &review.at); err != nil {
+			return nil, err
+		}
+		history[wordID] = append(history[wordID], review)
+	}
+	return history, rows.Err()
+}
+
+// idPlaceholders returns the placeholders and arguments for an IN clause
+func idPlaceholders(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// masteryDistribution counts words per mastery level out of totalWords words,
+// of which the reviewed ones are in levels
+func masteryDistribution(levels map[int]string, totalWords int) models.MasteryDistribution {
+	distribution := models.MasteryDistribution{New: totalWords - len(levels)}
+	for _, level := range levels {
+		switch level {
+		case MasteryLearning:
+			distribution.Learning++
+		case MasteryYoung:
+			distribution.Young++
+		case MasteryMature:
+			distribution.Mature++
+		case MasteryLapsed:
+			distribution.Lapsed++
+		}
+	}
+	return distribution
+}
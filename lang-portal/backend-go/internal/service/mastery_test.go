@@ -0,0 +1,87 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func TestMasteryLevel(t *testing.T) {
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	history := func(days []int, answers string) []reviewOutcome {
+		reviews := make([]reviewOutcome, len(answers))
+		for i, answer := range answers {
+			reviews[i] = reviewOutcome{correct: answer == '+', at: start.AddDate(0, 0, days[i])}
+		}
+		return reviews
+	}
+
+	tests := []struct {
+		name    string
+		reviews []reviewOutcome
+		want    string
+	}{
+		{"never reviewed", nil, MasteryNew},
+		{"still learning", history([]int{0, 1, 2}, "-++"), MasteryLearning},
+		{"three in a row", history([]int{0, 1, 2}, "+++"), MasteryYoung},
+		{"streak lasted three weeks", history([]int{0, 10, 21}, "+++"), MasteryMature},
+		{"failed after being young", history([]int{0, 1, 2, 3}, "+++-"), MasteryLapsed},
+		{"relearning after a lapse", history([]int{0, 1, 2, 3, 4}, "+++-+"), MasteryLearning},
+		{"failed before being young", history([]int{0, 1, 2}, "++-"), MasteryLearning},
+	}
+	for _, tt := range tests {
+		if got := masteryLevel(tt.reviews); got != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGroupMastery(t *testing.T) {
+	db := testdb.New(t)
+
+	// Word 1 is answered correctly in three sessions, word 2 only once
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES
+		(2, 1, datetime('now', '-2 days'), 1),
+		(3, 1, datetime('now', '-1 days'), 1),
+		(4, 1, datetime('now'), 1);
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(1, 2, 1, datetime('now', '-2 days')),
+		(1, 3, 1, datetime('now', '-1 days')),
+		(1, 4, 1, datetime('now')),
+		(2, 4, 0, datetime('now'));
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+
+	group, err := NewGroupsService(db).GetGroup(1)
+	if err != nil {
+		t.Fatalf("Failed to get group: %v", err)
+	}
+	want := models.MasteryDistribution{New: 2, Learning: 1, Young: 1}
+	if group.Mastery == nil || *group.Mastery != want {
+		t.Errorf("Got mastery %+v; want %+v", group.Mastery, want)
+	}
+
+	words, err := NewGroupsService(db).GetGroupWords(1, 1)
+	if err != nil {
+		t.Fatalf("Failed to get group words: %v", err)
+	}
+	levels := make(map[string]string)
+	for _, word := range words.Items {
+		levels[word.Term] = word.Mastery
+	}
+	if levels["犬"] != MasteryYoung || levels["猫"] != MasteryLearning || levels["鳥"] != MasteryNew {
+		t.Errorf("Unexpected word mastery levels: %v", levels)
+	}
+
+	progress, err := NewDashboardService(db).GetStudyProgress("")
+	if err != nil {
+		t.Fatalf("Failed to get study progress: %v", err)
+	}
+	if progress.TotalWordsLearned != 1 || progress.Mastery.New != progress.TotalAvailableWords-2 {
+		t.Errorf("Unexpected study progress: %+v", progress)
+	}
+}
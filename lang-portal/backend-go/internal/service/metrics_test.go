@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"lang-portal/internal/metrics"
+	"lang-portal/internal/testdb"
+)
+
+func TestReviewWordMetrics(t *testing.T) {
+	db := testdb.New(t)
+	db.Observe(metrics.ObserveQuery)
+	sessions := NewStudySessionsService(db, nil)
+
+	correct := metrics.ReviewsRecorded.WithLabelValues("true")
+	before := testutil.ToFloat64(correct)
+
+	if err := sessions.ReviewWord(1, 1, true); err != nil {
+		t.Fatalf("Failed to review word: %v", err)
+	}
+
+	if got := testutil.ToFloat64(correct) - before; got != 1 {
+		t.Errorf("Expected 1 correct review to be counted; got %v", got)
+	}
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	var queries uint64
+	for _, family := range families {
+		if family.GetName() != "langportal_db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "method" && label.GetValue() == "StudySessionsService.ReviewWord" {
+					queries = metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	if queries == 0 {
+		t.Error("Expected the queries of ReviewWord to be timed under StudySessionsService.ReviewWord")
+	}
+}
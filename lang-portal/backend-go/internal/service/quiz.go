@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/kana"
+	"lang-portal/internal/models"
+)
+
+// Quiz directions are named after the original Japanese portal. For other
+// languages ja_en asks for the meaning of a term, en_ja for the term of a
+// meaning and romaji_kana for the term of a transliteration.
+const (
+	QuizDirectionJapaneseToEnglish = "ja_en"
+	QuizDirectionEnglishToJapanese = "en_ja"
+	QuizDirectionRomajiToKana      = "romaji_kana"
+)
+
+const (
+	DefaultQuizQuestions = 10
+	MaxQuizQuestions     = 50
+	DefaultQuizChoices   = 4
+	MaxQuizChoices       = 6
+)
+
+type QuizService struct {
+	db       *models.DB
+	sessions *StudySessionsService
+}
+
+func NewQuizService(db *models.DB, sessions *StudySessionsService) *QuizService {
+	return &QuizService{db: db, sessions: sessions}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *QuizService) WithContext(ctx context.Context) *QuizService {
+	return &QuizService{db: s.db.WithContext(ctx), sessions: s.sessions.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *QuizService) labeled(method string) *QuizService {
+	c := *s
+	c.db = s.db.Labeled("QuizService." + method)
+	return &c
+}
+
+type quizWord struct {
+	ID              int
+	Language        string
+	Term            string
+	Transliteration string
+	Meaning         string
+}
+
+// ValidateQuizDirection reports whether direction is one of the supported quiz directions
+func ValidateQuizDirection(direction string) error {
+	switch direction {
+	case QuizDirectionJapaneseToEnglish, QuizDirectionEnglishToJapanese, QuizDirectionRomajiToKana:
+		return nil
+	}
+	return fmt.Errorf("invalid quiz direction %q", direction)
+}
+
+// promptAndAnswer returns the side of the word shown to the learner and the side they must pick
+func (w quizWord) promptAndAnswer(direction string) (string, string) {
+	switch direction {
+	case QuizDirectionEnglishToJapanese:
+		return w.Meaning, w.Term
+	case QuizDirectionRomajiToKana:
+		return w.Transliteration, w.Term
+	default:
+		return w.Term, w.Meaning
+	}
+}
+
+// GetQuiz builds a multiple-choice quiz from the words of the session's group.
+// The same session, direction, counts and seed always produce the same quiz.
+func (s *QuizService) GetQuiz(sessionID int, direction string, questionCount, choiceCount int, seed int64) (*models.QuizResponse, error) {
+	s = s.labeled("GetQuiz")
+	if err := ValidateQuizDirection(direction); err != nil {
+		return nil, err
+	}
+
+	var groupID int
+	if err := s.db.QueryRow("SELECT group_id FROM study_sessions WHERE id = ? AND deleted_at IS NULL", sessionID).Scan(&groupID); err != nil {
+		return nil, err
+	}
+
+	groupWords, err := s.getGroupWords(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if direction == QuizDirectionRomajiToKana {
+		groupWords = withTransliteration(groupWords)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(groupWords), func(i, j int) {
+		groupWords[i], groupWords[j] = groupWords[j], groupWords[i]
+	})
+	if questionCount > len(groupWords) {
+		questionCount = len(groupWords)
+	}
+
+	// Distractors come from the group first and are topped up with similar words
+	// from the rest of the vocabulary when the group is too small.
+	var otherWords []quizWord
+	if len(groupWords) < choiceCount {
+		otherWords, err = s.getWordsOutsideGroup(groupID)
+		if err != nil {
+			return nil, err
+		}
+		if direction == QuizDirectionRomajiToKana {
+			otherWords = withTransliteration(otherWords)
+		}
+	}
+
+	questions := make([]models.QuizQuestion, 0, questionCount)
+	for i, word := range groupWords[:questionCount] {
+		prompt, answer := word.promptAndAnswer(direction)
+		choices := append([]string{answer}, pickDistractors(rng, word, direction, groupWords, otherWords, choiceCount-1)...)
+		rng.Shuffle(len(choices), func(i, j int) {
+			choices[i], choices[j] = choices[j], choices[i]
+		})
+
+		questions = append(questions, models.QuizQuestion{
+			ID:      i + 1,
+			WordID:  word.ID,
+			Prompt:  prompt,
+			Choices: choices,
+		})
+	}
+
+	return &models.QuizResponse{
+		StudySessionID: sessionID,
+		GroupID:        groupID,
+		Direction:      direction,
+		Seed:           seed,
+		Questions:      questions,
+	}, nil
+}
+
+// GradeQuiz checks the answers against the session's group and records a
+// review for each of them.
+func (s *QuizService) GradeQuiz(sessionID int, direction string, answers []models.QuizAnswer) (*models.QuizGradeResponse, error) {
+	s = s.labeled("GradeQuiz")
+	if err := ValidateQuizDirection(direction); err != nil {
+		return nil, err
+	}
+
+	var groupID int
+	if err := s.db.QueryRow("SELECT group_id FROM study_sessions WHERE id = ? AND deleted_at IS NULL", sessionID).Scan(&groupID); err != nil {
+		return nil, err
+	}
+
+	groupWords, err := s.getGroupWords(groupID)
+	if err != nil {
+		return nil, err
+	}
+	wordsByID := make(map[int]quizWord, len(groupWords))
+	for _, word := range groupWords {
+		wordsByID[word.ID] = word
+	}
+
+	// A bad answer rejects the whole quiz before anything is recorded. The
+	// quiz may be retaken, so words reviewed earlier in the session are fine.
+	seen := make(map[int]bool, len(answers))
+	for _, answer := range answers {
+		if _, ok := wordsByID[answer.WordID]; !ok {
+			return nil, fmt.Errorf("word with ID %d does not exist in group %d", answer.WordID, groupID)
+		}
+		if answer.ResponseTimeMs < 0 {
+			return nil, fmt.Errorf("invalid quiz: word %d has a negative response time", answer.WordID)
+		}
+		if seen[answer.WordID] {
+			return nil, fmt.Errorf("invalid quiz: word %d is answered twice", answer.WordID)
+		}
+		seen[answer.WordID] = true
+	}
+
+	response := &models.QuizGradeResponse{
+		StudySessionID: sessionID,
+		Direction:      direction,
+		Results:        make([]models.QuizAnswerResult, 0, len(answers)),
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, answer := range answers {
+		word := wordsByID[answer.WordID]
+		_, expected := word.promptAndAnswer(direction)
+		correct := word.accepts(direction, answer.Answer)
+		if _, err := tx.Exec(insertReview, word.ID, sessionID, correct, answer.ResponseTimeMs); err != nil {
+			return nil, err
+		}
+
+		if correct {
+			response.CorrectCount++
+		}
+		response.Results = append(response.Results, models.QuizAnswerResult{
+			WordID:        word.ID,
+			Answer:        answer.Answer,
+			CorrectAnswer: expected,
+			Correct:       correct,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if len(answers) > 0 {
+		refreshTroubleWordsAfter(s.db, "w.id IN (SELECT word_id FROM word_review_items WHERE study_session_id = ?)", sessionID)
+	}
+	for i, result := range response.Results {
+		s.sessions.reviewRecorded(sessionID, result.WordID, result.Correct, answers[i].ResponseTimeMs)
+	}
+
+	response.TotalCount = len(answers)
+	if response.TotalCount > 0 {
+		response.Score = float64(response.CorrectCount) / float64(response.TotalCount) * 100
+	}
+
+	// Grading the quiz finishes the session, whichever words it covered
+	events.Publish(s.db.Context(), events.SessionCompleted, map[string]interface{}{
+		"study_session_id": sessionID,
+		"correct_count":    response.CorrectCount,
+		"total_count":      response.TotalCount,
+		"score":            response.Score,
+	})
+	return response, nil
+}
+
+func (s *QuizService) getGroupWords(groupID int) ([]quizWord, error) {
+	condition, args, err := groupWordsCondition(s.db, groupID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT w.id, w.language, w.term, w.transliteration, w.meaning
+		FROM words w
+		WHERE ` + condition + `
+		ORDER BY w.id
+	`
+	return s.queryWords(query, args...)
+}
+
+func (s *QuizService) getWordsOutsideGroup(groupID int) ([]quizWord, error) {
+	condition, args, err := groupWordsCondition(s.db, groupID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT w.id, w.language, w.term, w.transliteration, w.meaning
+		FROM words w
+		WHERE NOT (` + condition + `) AND w.deleted_at IS NULL
+		AND w.language = (SELECT language FROM groups WHERE id = ?)
+		ORDER BY w.id
+	`
+	return s.queryWords(query, append(args, groupID)...)
+}
+
+func (s *QuizService) queryWords(query string, args ...interface{}) ([]quizWord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var words []quizWord
+	for rows.Next() {
+		var word quizWord
+		if err := rows.Scan(&word.ID, &word.Language, &word.Term, &word.Transliteration, &word.Meaning); err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
+
+// pickDistractors returns up to n wrong answers for word. Group words are
+// chosen at random; words from outside the group are ranked by how similar
+// their answer looks to the correct one.
+func pickDistractors(rng *rand.Rand, word quizWord, direction string, groupWords, otherWords []quizWord, n int) []string {
+	_, answer := word.promptAndAnswer(direction)
+	seen := map[string]bool{answer: true}
+	distractors := make([]string, 0, n)
+
+	candidates := make([]string, 0, len(groupWords))
+	for _, other := range groupWords {
+		if other.ID == word.ID {
+			continue
+		}
+		_, candidate := other.promptAndAnswer(direction)
+		candidates = append(candidates, candidate)
+	}
+	rng.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	similar := make([]string, 0, len(otherWords))
+	for _, other := range otherWords {
+		_, candidate := other.promptAndAnswer(direction)
+		similar = append(similar, candidate)
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similarity(answer, similar[i]) > similarity(answer, similar[j])
+	})
+
+	for _, candidate := range append(candidates, similar...) {
+		if len(distractors) == n {
+			break
+		}
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		distractors = append(distractors, candidate)
+	}
+	return distractors
+}
+
+// similarity scores two answers by shared prefix and closeness in length
+func similarity(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prefix := 0
+	for prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	diff := len(ra) - len(rb)
+	if diff < 0 {
+		diff = -diff
+	}
+	return prefix*2 - diff
+}
+
+// accepts reports whether the learner's answer is correct. Japanese terms
+// may be typed in kana or in Hepburn or Kunrei romaji.
+func (w quizWord) accepts(direction, given string) bool {
+	_, expected := w.promptAndAnswer(direction)
+	if strings.EqualFold(strings.TrimSpace(given), strings.TrimSpace(expected)) {
+		return true
+	}
+	if direction == QuizDirectionJapaneseToEnglish || w.Language != models.LanguageJapanese {
+		return false
+	}
+	return kana.Equal(given, expected) || kana.Equal(given, w.Transliteration)
+}
+
+// withTransliteration drops words that have no transliteration to prompt with
+func withTransliteration(words []quizWord) []quizWord {
+	filtered := make([]quizWord, 0, len(words))
+	for _, word := range words {
+		if word.Transliteration != "" {
+			filtered = append(filtered, word)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func newTestQuizService(t *testing.T) *QuizService {
+	db := testdb.New(t)
+	signer, err := NewSessionTokenSigner([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return NewQuizService(db, NewStudySessionsService(db, signer))
+}
+
+func TestGetQuizIsDeterministic(t *testing.T) {
+	quiz := newTestQuizService(t)
+
+	first, err := quiz.GetQuiz(1, QuizDirectionJapaneseToEnglish, 3, 4, 42)
+	if err != nil {
+		t.Fatalf("Failed to build quiz: %v", err)
+	}
+	second, err := quiz.GetQuiz(1, QuizDirectionJapaneseToEnglish, 3, 4, 42)
+	if err != nil {
+		t.Fatalf("Failed to build quiz: %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same quiz for the same seed")
+	}
+
+	if len(first.Questions) != 3 {
+		t.Fatalf("Expected 3 questions; got %d", len(first.Questions))
+	}
+	for _, question := range first.Questions {
+		if len(question.Choices) != 4 {
+			t.Errorf("Expected 4 choices; got %v", question.Choices)
+		}
+		if question.WordID == 5 {
+			t.Errorf("Expected only words from the session's group")
+		}
+	}
+}
+
+func TestGradeQuizRecordsReviews(t *testing.T) {
+	quiz := newTestQuizService(t)
+
+	result, err := quiz.GradeQuiz(1, QuizDirectionEnglishToJapanese, []models.QuizAnswer{
+		{WordID: 1, Answer: "犬"},
+		{WordID: 2, Answer: "鳥"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to grade quiz: %v", err)
+	}
+	if result.CorrectCount != 1 || result.TotalCount != 2 || result.Score != 50 {
+		t.Errorf("Expected 1 of 2 correct; got %+v", result)
+	}
+
+	var reviews int
+	if err := quiz.db.QueryRow("SELECT COUNT(*) FROM word_review_items WHERE study_session_id = 1").Scan(&reviews); err != nil {
+		t.Fatalf("Failed to count reviews: %v", err)
+	}
+	if reviews != 2 {
+		t.Errorf("Expected 2 recorded reviews; got %d", reviews)
+	}
+
+	if _, err := quiz.GradeQuiz(1, QuizDirectionJapaneseToEnglish, []models.QuizAnswer{{WordID: 5, Answer: "horse"}}); err == nil {
+		t.Errorf("Expected an error for a word outside the group")
+	}
+}
+
+func TestGradeQuizRejectsWholePayload(t *testing.T) {
+	quiz := newTestQuizService(t)
+
+	payloads := [][]models.QuizAnswer{
+		{{WordID: 1, Answer: "dog"}, {WordID: 2, Answer: "cat"}, {WordID: 5, Answer: "horse"}},
+		{{WordID: 1, Answer: "dog"}, {WordID: 99, Answer: "?"}},
+		{{WordID: 1, Answer: "dog"}, {WordID: 1, Answer: "dog"}},
+		{{WordID: 1, Answer: "dog"}, {WordID: 2, Answer: "cat", ResponseTimeMs: -1}},
+	}
+	for _, answers := range payloads {
+		if _, err := quiz.GradeQuiz(1, QuizDirectionJapaneseToEnglish, answers); err == nil {
+			t.Errorf("Expected %+v to be rejected", answers)
+		}
+	}
+
+	var reviews int
+	if err := quiz.db.QueryRow("SELECT COUNT(*) FROM word_review_items").Scan(&reviews); err != nil {
+		t.Fatalf("Failed to count reviews: %v", err)
+	}
+	if reviews != 0 {
+		t.Errorf("Expected no reviews to be recorded; got %d", reviews)
+	}
+}
+
+func TestGradeQuizRetake(t *testing.T) {
+	quiz := newTestQuizService(t)
+
+	// Flashcard reviews and an earlier attempt do not keep the quiz from
+	// being taken again
+	if err := quiz.sessions.ReviewWord(1, 1, false); err != nil {
+		t.Fatalf("Failed to review word: %v", err)
+	}
+	answers := []models.QuizAnswer{{WordID: 1, Answer: "dog"}, {WordID: 2, Answer: "cat"}}
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := quiz.GradeQuiz(1, QuizDirectionJapaneseToEnglish, answers)
+		if err != nil {
+			t.Fatalf("Failed to grade attempt %d: %v", attempt+1, err)
+		}
+		if result.CorrectCount != 2 {
+			t.Errorf("Expected both answers to be correct; got %+v", result)
+		}
+	}
+
+	var reviews int
+	if err := quiz.db.QueryRow("SELECT COUNT(*) FROM word_review_items WHERE study_session_id = 1").Scan(&reviews); err != nil {
+		t.Fatalf("Failed to count reviews: %v", err)
+	}
+	if reviews != 5 {
+		t.Errorf("Expected 5 recorded reviews; got %d", reviews)
+	}
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/models"
+)
+
+const (
+	SentenceMatchLinked   = "linked"
+	SentenceMatchContains = "contains"
+)
+
+type SentencesService struct {
+	db *models.DB
+}
+
+func NewSentencesService(db *models.DB) *SentencesService {
+	return &SentencesService{db: db}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *SentencesService) WithContext(ctx context.Context) *SentencesService {
+	return &SentencesService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *SentencesService) labeled(method string) *SentencesService {
+	c := *s
+	c.db = s.db.Labeled("SentencesService." + method)
+	return &c
+}
+
+const sentenceColumns = `es.id, es.word_id, es.sentence, es.reading, es.translation, es.source, es.created_at`
+
+func (s *SentencesService) GetWordSentences(wordID int) ([]models.ExampleSentence, error) {
+	s = s.labeled("GetWordSentences")
+	if err := s.verifyWord(wordID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + sentenceColumns + `
+		FROM example_sentences es
+		WHERE es.word_id = ?
+		ORDER BY es.id
+	`
+	return s.querySentences(query, wordID)
+}
+
+// GetGroupSentences returns example sentences for the words of a group. With
+// SentenceMatchLinked only sentences attached to those words are returned;
+// SentenceMatchContains returns every sentence whose text contains one of them.
+func (s *SentencesService) GetGroupSentences(groupID int, match string, page int) ([]models.ExampleSentence, *models.Pagination, error) {
+	s = s.labeled("GetGroupSentences")
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = ? AND deleted_at IS NULL)", groupID).Scan(&exists); err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	wordsCondition, args, err := groupWordsCondition(s.db, groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var condition string
+	switch match {
+	case SentenceMatchLinked:
+		condition = `es.word_id IN (SELECT w.id FROM words w WHERE ` + wordsCondition + `)`
+	case SentenceMatchContains:
+		condition = `EXISTS (
+			SELECT 1 FROM words w
+			WHERE ` + wordsCondition + ` AND instr(es.sentence, w.term) > 0
+		)`
+	default:
+		return nil, nil, fmt.Errorf("invalid match %q", match)
+	}
+
+	itemsPerPage := 100
+	offset := (page - 1) * itemsPerPage
+
+	var totalItems int
+	countQuery := `SELECT COUNT(*) FROM example_sentences es WHERE ` + condition
+	if err := s.db.QueryRow(countQuery, args...).Scan(&totalItems); err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+		SELECT ` + sentenceColumns + `
+		FROM example_sentences es
+		WHERE ` + condition + `
+		ORDER BY es.id
+		LIMIT ? OFFSET ?
+	`
+	sentences, err := s.querySentences(query, append(args, itemsPerPage, offset)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pagination := &models.Pagination{
+		CurrentPage:  page,
+		TotalPages:   (totalItems + itemsPerPage - 1) / itemsPerPage,
+		TotalItems:   totalItems,
+		ItemsPerPage: itemsPerPage,
+	}
+
+	return sentences, pagination, nil
+}
+
+func (s *SentencesService) GetSentence(id int) (*models.ExampleSentence, error) {
+	s = s.labeled("GetSentence")
+	query := `
+		SELECT ` + sentenceColumns + `
+		FROM example_sentences es
+		WHERE es.id = ? AND es.word_id IN (SELECT id FROM words WHERE deleted_at IS NULL)
+	`
+
+	var sentence models.ExampleSentence
+	if err := s.db.QueryRow(query, id).Scan(
+		&sentence.ID,
+		&sentence.WordID,
+		&sentence.Sentence,
+		&sentence.Reading,
+		&sentence.Translation,
+		&sentence.Source,
+		&sentence.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &sentence, nil
+}
+
+func (s *SentencesService) CreateSentence(sentence models.ExampleSentence) (*models.ExampleSentence, error) {
+	s = s.labeled("CreateSentence")
+	if err := s.verifyWord(sentence.WordID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO example_sentences (word_id, sentence, reading, translation, source)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	var id int
+	if err := s.db.QueryRow(query,
+		sentence.WordID,
+		sentence.Sentence,
+		sentence.Reading,
+		sentence.Translation,
+		sentence.Source,
+	).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	events.PublishShared(events.WordUpdated, map[string]interface{}{"id": sentence.WordID})
+	return s.GetSentence(id)
+}
+
+func (s *SentencesService) UpdateSentence(id int, sentence models.ExampleSentence) (*models.ExampleSentence, error) {
+	s = s.labeled("UpdateSentence")
+	query := `
+		UPDATE example_sentences
+		SET sentence = ?, reading = ?, translation = ?, source = ?
+		WHERE id = ? AND word_id IN (SELECT id FROM words WHERE deleted_at IS NULL)
+	`
+
+	result, err := s.db.Exec(query,
+		sentence.Sentence,
+		sentence.Reading,
+		sentence.Translation,
+		sentence.Source,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	updated, err := s.GetSentence(id)
+	if err != nil {
+		return nil, err
+	}
+	events.PublishShared(events.WordUpdated, map[string]interface{}{"id": updated.WordID})
+	return updated, nil
+}
+
+func (s *SentencesService) DeleteSentence(id int) error {
+	s = s.labeled("DeleteSentence")
+	var wordID int
+	if err := s.db.QueryRow(`
+		DELETE FROM example_sentences
+		WHERE id = ? AND word_id IN (SELECT id FROM words WHERE deleted_at IS NULL)
+		RETURNING word_id
+	`, id).Scan(&wordID); err != nil {
+		return err
+	}
+	events.PublishShared(events.WordUpdated, map[string]interface{}{"id": wordID})
+	return nil
+}
+
+func (s *SentencesService) verifyWord(wordID int) error {
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM words WHERE id = ? AND deleted_at IS NULL)", wordID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SentencesService) querySentences(query string, args ...interface{}) ([]models.ExampleSentence, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sentences := make([]models.ExampleSentence, 0)
+	for rows.Next() {
+		var sentence models.ExampleSentence
+		if err := rows.Scan(
+			&sentence.ID,
+			&sentence.WordID,
+			&sentence.Sentence,
+			&sentence.Reading,
+			&sentence.Translation,
+			&sentence.Source,
+			&sentence.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		sentences = append(sentences, sentence)
+	}
+	return sentences, rows.Err()
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func TestGroupSentences(t *testing.T) {
+	sentences := NewSentencesService(testdb.New(t))
+
+	if _, err := sentences.CreateSentence(models.ExampleSentence{WordID: 1, Sentence: "犬が好きです。"}); err != nil {
+		t.Fatalf("Failed to create sentence: %v", err)
+	}
+	// Attached to a word outside group 1, but mentions 猫
+	if _, err := sentences.CreateSentence(models.ExampleSentence{WordID: 5, Sentence: "馬と猫"}); err != nil {
+		t.Fatalf("Failed to create sentence: %v", err)
+	}
+
+	linked, _, err := sentences.GetGroupSentences(1, SentenceMatchLinked, 1)
+	if err != nil {
+		t.Fatalf("Failed to get linked sentences: %v", err)
+	}
+	if len(linked) != 1 {
+		t.Errorf("Expected 1 linked sentence; got %d", len(linked))
+	}
+
+	containing, pagination, err := sentences.GetGroupSentences(1, SentenceMatchContains, 1)
+	if err != nil {
+		t.Fatalf("Failed to get containing sentences: %v", err)
+	}
+	if len(containing) != 2 || pagination.TotalItems != 2 {
+		t.Errorf("Expected 2 sentences containing group words; got %d", len(containing))
+	}
+
+	if _, err := sentences.CreateSentence(models.ExampleSentence{WordID: 999, Sentence: "?"}); err != sql.ErrNoRows {
+		t.Errorf("Expected %v for a missing word; got %v", sql.ErrNoRows, err)
+	}
+}
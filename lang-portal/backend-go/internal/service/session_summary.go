@@ -0,0 +1,258 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"lang-portal/internal/models"
+)
+
+// Reasons for the recommended next group of a session summary
+const (
+	RecommendRepeat       = "repeat"
+	RecommendTroubleWords = "trouble_words"
+	RecommendLeastLearned = "least_learned"
+)
+
+// repeatAccuracy is the session accuracy below which the same group is recommended again
+const repeatAccuracy = 60
+
+// masteryRank orders mastery levels from least to best learned
+var masteryRank = map[string]int{
+	MasteryNew:      0,
+	MasteryLapsed:   1,
+	MasteryLearning: 2,
+	MasteryYoung:    3,
+	MasteryMature:   4,
+}
+
+// GetStudySessionSummary returns the results of a session: accuracy,
+// duration, the reviews in order, how the mastery of the reviewed words
+// changed compared with before the session, and which group to study next.
+func (s *StudySessionsService) GetStudySessionSummary(id int) (*models.StudySessionSummary, error) {
+	s = s.labeled("GetStudySessionSummary")
+	query := `
+		SELECT ss.id, ss.group_id, g.name, g.language, sa.name, ss.created_at
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		JOIN study_activities sa ON ss.study_activity_id = sa.id
+		WHERE ss.id = ? AND ss.deleted_at IS NULL
+	`
+
+	summary := &models.StudySessionSummary{
+		Timeline:      make([]models.SessionReview, 0),
+		Improved:      make([]models.SessionWordChange, 0),
+		Regressed:     make([]models.SessionWordChange, 0),
+		NewlyMastered: make([]models.SessionWordChange, 0),
+	}
+	var language string
+	if err := s.db.QueryRow(query, id).Scan(
+		&summary.ID,
+		&summary.GroupID,
+		&summary.GroupName,
+		&language,
+		&summary.ActivityName,
+		&summary.StartedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	timelineQuery := `
+		SELECT wri.word_id, w.term, wri.correct, wri.created_at
+		FROM word_review_items wri
+		JOIN words w ON wri.word_id = w.id
+		WHERE wri.study_session_id = ? AND wri.deleted_at IS NULL
+		ORDER BY wri.created_at, wri.rowid
+	`
+	rows, err := s.db.Query(timelineQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := make(map[int]string)
+	var wordIDs []int
+	for rows.Next() {
+		var review models.SessionReview
+		if err := rows.Scan(&review.WordID, &review.Term, &review.Correct, &review.CreatedAt); err != nil {
+			return nil, err
+		}
+		summary.Timeline = append(summary.Timeline, review)
+		if review.Correct {
+			summary.CorrectCount++
+		}
+		if _, ok := terms[review.WordID]; !ok {
+			terms[review.WordID] = review.Term
+			wordIDs = append(wordIDs, review.WordID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summary.ReviewCount = len(summary.Timeline)
+	summary.WrongCount = summary.ReviewCount - summary.CorrectCount
+	if summary.ReviewCount > 0 {
+		accuracy := float64(summary.CorrectCount) / float64(summary.ReviewCount) * 100
+		summary.Accuracy = math.Round(accuracy*10) / 10
+
+		endedAt := summary.Timeline[summary.ReviewCount-1].CreatedAt
+		summary.EndedAt = &endedAt
+		summary.DurationSeconds = int(endedAt.Sub(summary.StartedAt).Seconds())
+	}
+
+	if err := s.compareMastery(summary, id, wordIDs, terms); err != nil {
+		return nil, err
+	}
+
+	if summary.RecommendedNextGroup, err = s.recommendNextGroup(summary, language); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// compareMastery sorts the reviewed words into improved, regressed and newly
+// mastered by comparing their mastery before the session, from reviews in
+// earlier sessions, with their mastery including the session's reviews
+func (s *StudySessionsService) compareMastery(summary *models.StudySessionSummary, sessionID int, wordIDs []int, terms map[int]string) error {
+	if len(wordIDs) == 0 {
+		return nil
+	}
+	placeholders, args := idPlaceholders(wordIDs)
+	args = append(args, sessionID, summary.StartedAt.UTC().Format("2006-01-02 15:04:05"))
+
+	before, err := wordMastery(s.db, `wri.word_id IN (`+placeholders+`)
+		AND wri.study_session_id != ? AND wri.created_at < ?`, args...)
+	if err != nil {
+		return err
+	}
+	after, err := wordMastery(s.db, `wri.word_id IN (`+placeholders+`)
+		AND (wri.study_session_id = ? OR wri.created_at < ?)`, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, wordID := range wordIDs {
+		change := models.SessionWordChange{WordID: wordID, Term: terms[wordID], Before: MasteryNew, After: MasteryNew}
+		if level, ok := before[wordID]; ok {
+			change.Before = level
+		}
+		if level, ok := after[wordID]; ok {
+			change.After = level
+		}
+
+		wasLearned := change.Before == MasteryYoung || change.Before == MasteryMature
+		isLearned := change.After == MasteryYoung || change.After == MasteryMature
+		if isLearned && !wasLearned {
+			summary.NewlyMastered = append(summary.NewlyMastered, change)
+		}
+
+		// Words seen for the first time have nothing to compare with
+		if change.Before == MasteryNew {
+			continue
+		}
+		switch {
+		case masteryRank[change.After] > masteryRank[change.Before]:
+			summary.Improved = append(summary.Improved, change)
+		case masteryRank[change.After] < masteryRank[change.Before]:
+			summary.Regressed = append(summary.Regressed, change)
+		}
+	}
+	return nil
+}
+
+// recommendNextGroup picks the group to study after a session: the same
+// group again after a poor session, otherwise the language's trouble words
+// when there are any, otherwise the group with the smallest share of
+// learned words
+func (s *StudySessionsService) recommendNextGroup(summary *models.StudySessionSummary, language string) (*models.RecommendedGroup, error) {
+	if summary.ReviewCount > 0 && summary.Accuracy < repeatAccuracy {
+		return &models.RecommendedGroup{ID: summary.GroupID, Name: summary.GroupName, Reason: RecommendRepeat}, nil
+	}
+
+	rows, err := s.db.Query("SELECT id, name, kind FROM groups WHERE language = ? AND deleted_at IS NULL ORDER BY id", language)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		id         int
+		name, kind string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.name, &c.kind); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range candidates {
+		if c.kind != GroupKindLeeches {
+			continue
+		}
+		count, err := countGroupWords(s.db, c.id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return &models.RecommendedGroup{ID: c.id, Name: c.name, Reason: RecommendTroubleWords}, nil
+		}
+	}
+
+	levels, err := wordMastery(s.db, "w.language = ?", language)
+	if err != nil {
+		return nil, err
+	}
+
+	type share struct {
+		group   candidate
+		learned float64
+	}
+	var shares []share
+	for _, c := range candidates {
+		if c.id == summary.GroupID || c.kind == GroupKindLeeches {
+			continue
+		}
+		condition, args, err := groupWordsCondition(s.db, c.id)
+		if err != nil {
+			return nil, err
+		}
+		wordRows, err := s.db.Query("SELECT w.id FROM words w WHERE "+condition, args...)
+		if err != nil {
+			return nil, err
+		}
+		total, learned := 0, 0
+		for wordRows.Next() {
+			var wordID int
+			if err := wordRows.Scan(&wordID); err != nil {
+				wordRows.Close()
+				return nil, err
+			}
+			total++
+			if level := levels[wordID]; level == MasteryYoung || level == MasteryMature {
+				learned++
+			}
+		}
+		wordRows.Close()
+		if err := wordRows.Err(); err != nil {
+			return nil, err
+		}
+		if total > 0 && learned < total {
+			shares = append(shares, share{group: c, learned: float64(learned) / float64(total)})
+		}
+	}
+	if len(shares) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(shares, func(i, j int) bool { return shares[i].learned < shares[j].learned })
+	best := shares[0].group
+	return &models.RecommendedGroup{ID: best.id, Name: best.name, Reason: RecommendLeastLearned}, nil
+}
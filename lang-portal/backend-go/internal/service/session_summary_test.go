@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+
+	"lang-portal/internal/testdb"
+)
+
+func TestStudySessionSummary(t *testing.T) {
+	db := testdb.New(t)
+
+	// Before session 5, 犬 was young and 猫 was still learning
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES
+		(2, 1, datetime('now', '-4 days'), 1),
+		(3, 1, datetime('now', '-3 days'), 1),
+		(4, 1, datetime('now', '-2 days'), 1),
+		(5, 1, datetime('now', '-10 minutes'), 1);
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(1, 2, 1, datetime('now', '-4 days')),
+		(1, 3, 1, datetime('now', '-3 days')),
+		(1, 4, 1, datetime('now', '-2 days')),
+		(2, 3, 1, datetime('now', '-3 days')),
+		(2, 4, 1, datetime('now', '-2 days')),
+		(2, 5, 1, datetime('now', '-9 minutes')),
+		(1, 5, 0, datetime('now', '-8 minutes')),
+		(3, 5, 1, datetime('now', '-5 minutes'));
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+
+	summary, err := NewStudySessionsService(db, nil).GetStudySessionSummary(5)
+	if err != nil {
+		t.Fatalf("Failed to get summary: %v", err)
+	}
+
+	if summary.ReviewCount != 3 || summary.CorrectCount != 2 || summary.Accuracy != 66.7 {
+		t.Errorf("Unexpected counts: %+v", summary)
+	}
+	if summary.DurationSeconds < 299 || summary.DurationSeconds > 301 {
+		t.Errorf("Expected a duration of 5 minutes; got %d seconds", summary.DurationSeconds)
+	}
+	if len(summary.Timeline) != 3 || summary.Timeline[0].Term != "猫" || summary.Timeline[2].Term != "鳥" {
+		t.Errorf("Expected reviews in order; got %+v", summary.Timeline)
+	}
+
+	if len(summary.Improved) != 1 || summary.Improved[0].Term != "猫" || summary.Improved[0].After != MasteryYoung {
+		t.Errorf("Expected 猫 to improve to young; got %+v", summary.Improved)
+	}
+	if len(summary.Regressed) != 1 || summary.Regressed[0].Term != "犬" || summary.Regressed[0].After != MasteryLapsed {
+		t.Errorf("Expected 犬 to lapse; got %+v", summary.Regressed)
+	}
+	if len(summary.NewlyMastered) != 1 || summary.NewlyMastered[0].Term != "猫" {
+		t.Errorf("Expected 猫 to be newly mastered; got %+v", summary.NewlyMastered)
+	}
+
+	next := summary.RecommendedNextGroup
+	if next == nil || next.ID != 2 || next.Reason != RecommendLeastLearned {
+		t.Errorf("Expected group 2 to be recommended next; got %+v", next)
+	}
+
+	if _, err := NewStudySessionsService(db, nil).GetStudySessionSummary(99); err == nil {
+		t.Error("Expected an error for a missing session")
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSessionToken = errors.New("invalid session token")
+	ErrExpiredSessionToken = errors.New("session token has expired")
+)
+
+// SessionTokenSigner issues and verifies short-lived tokens that let a
+// launched study activity report reviews for a single study session.
+type SessionTokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewSessionTokenSigner creates a signer. When secret is empty a random one
+// is generated, so tokens only stay valid for the lifetime of the process.
+func NewSessionTokenSigner(secret []byte, ttl time.Duration) (*SessionTokenSigner, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate session token secret: %v", err)
+		}
+	}
+	return &SessionTokenSigner{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}, nil
+}
+
+// Sign returns a token bound to the session and group, and its expiry time
+func (s *SessionTokenSigner) Sign(sessionID, groupID int) (string, time.Time) {
+	expiresAt := s.now().Add(s.ttl).UTC().Truncate(time.Second)
+	payload := fmt.Sprintf("%d:%d:%d", sessionID, groupID, expiresAt.Unix())
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + s.signature(encoded), expiresAt
+}
+
+// Verify checks that the token was issued for the given session and has not expired
+func (s *SessionTokenSigner) Verify(token string, sessionID int) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidSessionToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(encoded))) {
+		return ErrInvalidSessionToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSessionToken
+	}
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 3 {
+		return ErrInvalidSessionToken
+	}
+
+	tokenSessionID, err := strconv.Atoi(parts[0])
+	if err != nil || tokenSessionID != sessionID {
+		return ErrInvalidSessionToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return ErrInvalidSessionToken
+	}
+	if s.now().Unix() > expiresAt {
+		return ErrExpiredSessionToken
+	}
+
+	return nil
+}
+
+func (s *SessionTokenSigner) signature(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
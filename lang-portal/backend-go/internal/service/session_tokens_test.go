@@ -0,0 +1,56 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSessionTokenSigner(t *testing.T) {
+	signer, err := NewSessionTokenSigner([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	token, expiresAt := signer.Sign(12, 3)
+	if !expiresAt.After(time.Now()) {
+		t.Errorf("Expected expiry in the future; got %v", expiresAt)
+	}
+
+	if err := signer.Verify(token, 12); err != nil {
+		t.Errorf("Expected token to verify; got %v", err)
+	}
+	if err := signer.Verify(token, 13); err != ErrInvalidSessionToken {
+		t.Errorf("Expected %v for another session; got %v", ErrInvalidSessionToken, err)
+	}
+	if err := signer.Verify(token+"x", 12); err != ErrInvalidSessionToken {
+		t.Errorf("Expected %v for tampered token; got %v", ErrInvalidSessionToken, err)
+	}
+
+	signer.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := signer.Verify(token, 12); err != ErrExpiredSessionToken {
+		t.Errorf("Expected %v; got %v", ErrExpiredSessionToken, err)
+	}
+}
+
+func TestBuildLaunchURL(t *testing.T) {
+	launchURL, err := buildLaunchURL("http://localhost:8080/quiz?session={session_id}", 5, 2, 1, "abc")
+	if err != nil {
+		t.Fatalf("Failed to build launch URL: %v", err)
+	}
+
+	parsed, err := url.Parse(launchURL)
+	if err != nil {
+		t.Fatalf("Failed to parse launch URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("session") != "5" {
+		t.Errorf("Expected expanded session placeholder; got %q", query.Get("session"))
+	}
+	if query.Get("group_id") != "2" || query.Get("token") != "abc" {
+		t.Errorf("Expected appended group_id and token; got %q", parsed.RawQuery)
+	}
+	if query.Has("session_id") {
+		t.Errorf("Expected session_id not to be appended when templated; got %q", parsed.RawQuery)
+	}
+}
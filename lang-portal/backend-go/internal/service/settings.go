@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/models"
+)
+
+const (
+	GoalTypeReviews = "reviews"
+	GoalTypeMinutes = "minutes"
+)
+
+// dateLayout is the format of local calendar dates such as daily_goals.effective_from
+const dateLayout = "2006-01-02"
+
+type SettingsService struct {
+	db *models.DB
+}
+
+func NewSettingsService(db *models.DB) *SettingsService {
+	return &SettingsService{db: db}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *SettingsService) WithContext(ctx context.Context) *SettingsService {
+	return &SettingsService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *SettingsService) labeled(method string) *SettingsService {
+	c := *s
+	c.db = s.db.Labeled("SettingsService." + method)
+	return &c
+}
+
+func (s *SettingsService) GetSettings() (*models.SettingsResponse, error) {
+	s = s.labeled("GetSettings")
+	location, err := loadUserLocation(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	goal, err := goalOn(s.db, time.Now().In(location).Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	thresholds, err := loadLeechThresholds(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SettingsResponse{
+		Timezone:        location.String(),
+		DailyGoal:       goal,
+		LeechThresholds: thresholds,
+	}, nil
+}
+
+// UpdateSettings changes the timezone, the daily goal and the leech
+// thresholds. Nil arguments are left unchanged. A new goal applies from today
+// in the learner's timezone, so days already past keep being measured against
+// the goal they had.
+func (s *SettingsService) UpdateSettings(timezone *string, goal *models.DailyGoal, leech *models.LeechThresholds) (*models.SettingsResponse, error) {
+	s = s.labeled("UpdateSettings")
+	if timezone != nil {
+		if _, err := time.LoadLocation(*timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", *timezone)
+		}
+	}
+	if goal != nil {
+		if goal.GoalType != GoalTypeReviews && goal.GoalType != GoalTypeMinutes {
+			return nil, fmt.Errorf("invalid goal type %q", goal.GoalType)
+		}
+		if goal.Target < 1 {
+			return nil, fmt.Errorf("goal target must be positive")
+		}
+	}
+	if leech != nil && (leech.Failures < 1 || leech.Lapses < 1) {
+		return nil, fmt.Errorf("invalid leech thresholds: failures and lapses must be positive")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if timezone != nil {
+		if _, err := tx.Exec("UPDATE user_settings SET timezone = ?, updated_at = CURRENT_TIMESTAMP WHERE id = 1", *timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	if goal != nil {
+		var name string
+		if err := tx.QueryRow("SELECT timezone FROM user_settings WHERE id = 1").Scan(&name); err != nil {
+			return nil, err
+		}
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, err
+		}
+		today := time.Now().In(location).Format(dateLayout)
+
+		if _, err := tx.Exec("DELETE FROM daily_goals WHERE effective_from = ?", today); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO daily_goals (goal_type, target, effective_from) VALUES (?, ?, ?)",
+			goal.GoalType, goal.Target, today,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if leech != nil {
+		if _, err := tx.Exec(
+			"UPDATE user_settings SET leech_failure_threshold = ?, leech_lapse_threshold = ?, updated_at = CURRENT_TIMESTAMP WHERE id = 1",
+			leech.Failures, leech.Lapses,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// New thresholds change which words are leeches
+	if leech != nil {
+		refreshTroubleWordsAfter(s.db, "1 = 1")
+	}
+
+	events.PublishShared(events.SettingsUpdated, nil)
+	return s.GetSettings()
+}
+
+// loadUserLocation returns the learner's configured timezone
+func loadUserLocation(db *models.DB) (*time.Location, error) {
+	var name string
+	err := db.QueryRow("SELECT timezone FROM user_settings WHERE id = 1").Scan(&name)
+	if err == sql.ErrNoRows {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(name)
+}
+
+// goalOn returns the daily goal in effect on a local date, or nil when none was set yet
+func goalOn(db *models.DB, date string) (*models.DailyGoal, error) {
+	query := `
+		SELECT goal_type, target
+		FROM daily_goals
+		WHERE effective_from <= ?
+		ORDER BY effective_from DESC, id DESC
+		LIMIT 1
+	`
+
+	var goal models.DailyGoal
+	err := db.QueryRow(query, date).Scan(&goal.GoalType, &goal.Target)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
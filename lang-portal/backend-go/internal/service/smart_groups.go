@@ -0,0 +1,214 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/models"
+)
+
+const GroupKindSmart = "smart"
+
+// Smart group rule types
+const (
+	RuleAccuracyBelow     = "accuracy_below"
+	RuleNotReviewedInDays = "not_reviewed_in_days"
+	RuleInGroup           = "in_group"
+	RuleNotInGroup        = "not_in_group"
+	RuleAddedWithinDays   = "added_within_days"
+)
+
+// MaxGroupRules bounds the number of rules of a smart group
+const MaxGroupRules = 10
+
+// groupWordsCondition returns an SQL condition on words aliased w that
+// selects the words of a group. Static and leech groups use their
+// words_groups rows; smart groups evaluate their rules. Deleted words are
+// left out, and deleted groups are not found.
+func groupWordsCondition(db *models.DB, groupID int) (string, []interface{}, error) {
+	var kind, language string
+	var rules sql.NullString
+	err := db.QueryRow("SELECT kind, language, rules FROM groups WHERE id = ? AND deleted_at IS NULL", groupID).Scan(&kind, &language, &rules)
+	if err != nil {
+		return "", nil, err
+	}
+	if kind != GroupKindSmart {
+		return "w.deleted_at IS NULL AND w.id IN (SELECT word_id FROM words_groups WHERE group_id = ?)", []interface{}{groupID}, nil
+	}
+
+	parsed, err := parseGroupRules(rules.String)
+	if err != nil {
+		return "", nil, fmt.Errorf("group %d: %w", groupID, err)
+	}
+	condition, args := rulesCondition(parsed)
+	return "w.deleted_at IS NULL AND w.language = ? AND " + condition, append([]interface{}{language}, args...), nil
+}
+
+func parseGroupRules(value string) ([]models.GroupRule, error) {
+	var rules []models.GroupRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules: %v", err)
+	}
+	return rules, nil
+}
+
+// rulesCondition returns the SQL condition on words aliased w for rules that
+// passed validateGroupRules. Every word matches an empty rule list.
+func rulesCondition(rules []models.GroupRule) (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	for _, rule := range rules {
+		switch rule.Type {
+		case RuleAccuracyBelow:
+			conditions = append(conditions, `w.id IN (
+				SELECT word_id FROM word_review_items
+				WHERE deleted_at IS NULL
+				GROUP BY word_id
+				HAVING AVG(CASE WHEN correct THEN 100.0 ELSE 0 END) < ?
+			)`)
+			args = append(args, rule.Value)
+		case RuleNotReviewedInDays:
+			conditions = append(conditions, `w.id NOT IN (
+				SELECT word_id FROM word_review_items WHERE created_at >= datetime('now', ?) AND deleted_at IS NULL
+			)`)
+			args = append(args, fmt.Sprintf("-%d days", int(rule.Value)))
+		case RuleInGroup:
+			conditions = append(conditions, `w.id IN (SELECT word_id FROM words_groups WHERE group_id = ?)`)
+			args = append(args, rule.GroupID)
+		case RuleNotInGroup:
+			conditions = append(conditions, `w.id NOT IN (SELECT word_id FROM words_groups WHERE group_id = ?)`)
+			args = append(args, rule.GroupID)
+		case RuleAddedWithinDays:
+			conditions = append(conditions, `w.created_at >= datetime('now', ?)`)
+			args = append(args, fmt.Sprintf("-%d days", int(rule.Value)))
+		}
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// validateGroupRules checks rules before a smart group is saved. Group rules
+// may only refer to static or leech groups, so smart groups never nest.
+func (s *GroupsService) validateGroupRules(rules []models.GroupRule) error {
+	if len(rules) > MaxGroupRules {
+		return fmt.Errorf("invalid rules: at most %d rules are allowed", MaxGroupRules)
+	}
+	for _, rule := range rules {
+		switch rule.Type {
+		case RuleAccuracyBelow:
+			if rule.Value <= 0 || rule.Value > 100 {
+				return fmt.Errorf("invalid rules: %s needs a value between 0 and 100", rule.Type)
+			}
+		case RuleNotReviewedInDays, RuleAddedWithinDays:
+			if rule.Value < 1 || rule.Value != float64(int(rule.Value)) {
+				return fmt.Errorf("invalid rules: %s needs a whole number of days", rule.Type)
+			}
+		case RuleInGroup, RuleNotInGroup:
+			var kind string
+			err := s.db.QueryRow("SELECT kind FROM groups WHERE id = ? AND deleted_at IS NULL", rule.GroupID).Scan(&kind)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("invalid rules: group with ID %d does not exist", rule.GroupID)
+			}
+			if err != nil {
+				return err
+			}
+			if kind == GroupKindSmart {
+				return fmt.Errorf("invalid rules: %s cannot refer to smart group %d", rule.Type, rule.GroupID)
+			}
+		default:
+			return fmt.Errorf("invalid rules: unknown rule type %q", rule.Type)
+		}
+	}
+	return nil
+}
+
+// CreateSmartGroup saves a group whose words are selected by rules
+func (s *GroupsService) CreateSmartGroup(name, language string, rules []models.GroupRule) (*models.GroupWithStats, error) {
+	s = s.labeled("CreateSmartGroup")
+	if err := s.validateGroupRules(rules); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = s.db.QueryRow(
+		"INSERT INTO groups (name, language, kind, rules) VALUES (?, ?, ?, ?) RETURNING id",
+		name, language, GroupKindSmart, string(encoded),
+	).Scan(&id)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return nil, fmt.Errorf("invalid name: a group named %q already exists", name)
+		}
+		return nil, err
+	}
+	events.PublishShared(events.GroupCreated, map[string]interface{}{"id": id})
+	return s.GetGroup(id)
+}
+
+// UpdateSmartGroup renames a smart group and replaces its rules
+func (s *GroupsService) UpdateSmartGroup(id int, name string, rules []models.GroupRule) (*models.GroupWithStats, error) {
+	s = s.labeled("UpdateSmartGroup")
+	if err := s.verifySmartGroup(id); err != nil {
+		return nil, err
+	}
+	if err := s.validateGroupRules(rules); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Exec("UPDATE groups SET name = ?, rules = ? WHERE id = ?", name, string(encoded), id); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return nil, fmt.Errorf("invalid name: a group named %q already exists", name)
+		}
+		return nil, err
+	}
+	events.PublishShared(events.GroupUpdated, map[string]interface{}{"id": id})
+	return s.GetGroup(id)
+}
+
+// DeleteSmartGroup moves a smart group that has not been studied to the trash
+func (s *GroupsService) DeleteSmartGroup(id int) error {
+	s = s.labeled("DeleteSmartGroup")
+	if err := s.verifySmartGroup(id); err != nil {
+		return err
+	}
+	return s.DeleteGroup(id)
+}
+
+func (s *GroupsService) verifySmartGroup(id int) error {
+	var kind string
+	if err := s.db.QueryRow("SELECT kind FROM groups WHERE id = ? AND deleted_at IS NULL", id).Scan(&kind); err != nil {
+		return err
+	}
+	if kind != GroupKindSmart {
+		return fmt.Errorf("group %d is not a smart group", id)
+	}
+	return nil
+}
+
+// groupRules returns the rules of a smart group, or nil for other groups
+func groupRules(kind string, rules sql.NullString) ([]models.GroupRule, error) {
+	if kind != GroupKindSmart {
+		return nil, nil
+	}
+	return parseGroupRules(rules.String)
+}
+
+// countGroupWords counts the words of a group
+func countGroupWords(db *models.DB, groupID int) (int, error) {
+	condition, args, err := groupWordsCondition(db, groupID)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM words w WHERE "+condition, args...).Scan(&count)
+	return count, err
+}
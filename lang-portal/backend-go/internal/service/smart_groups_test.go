@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"lang-portal/internal/models"
+	"lang-portal/internal/testdb"
+)
+
+func TestSmartGroups(t *testing.T) {
+	db := testdb.New(t)
+	groups := NewGroupsService(db)
+
+	// 犬 is always right, 猫 always wrong, 鳥 was reviewed long ago
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES (2, 1, datetime('now', '-30 days'), 1);
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(1, 1, 1, datetime('now', '-1 day')),
+		(2, 1, 0, datetime('now', '-1 day')),
+		(3, 2, 1, datetime('now', '-30 days'));
+		UPDATE words SET created_at = datetime('now', '-30 days') WHERE id != 4;
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+
+	terms := func(groupID int) map[string]bool {
+		t.Helper()
+		words, err := groups.GetGroupWords(groupID, 1)
+		if err != nil {
+			t.Fatalf("Failed to get words of group %d: %v", groupID, err)
+		}
+		set := make(map[string]bool)
+		for _, word := range words.Items {
+			set[word.Term] = true
+		}
+		return set
+	}
+
+	tests := []struct {
+		name  string
+		rules []models.GroupRule
+		want  []string
+	}{
+		{"low accuracy", []models.GroupRule{{Type: RuleAccuracyBelow, Value: 60}}, []string{"猫"}},
+		{"not reviewed lately", []models.GroupRule{{Type: RuleNotReviewedInDays, Value: 14}}, []string{"鳥", "魚", "馬"}},
+		{"in one group and not another", []models.GroupRule{
+			{Type: RuleInGroup, GroupID: 1},
+			{Type: RuleNotInGroup, GroupID: 2},
+			{Type: RuleNotReviewedInDays, Value: 14},
+		}, []string{"鳥", "魚"}},
+		{"added this week", []models.GroupRule{{Type: RuleAddedWithinDays, Value: 7}}, []string{"魚"}},
+	}
+	var smartGroupID int
+	for _, tt := range tests {
+		group, err := groups.CreateSmartGroup(tt.name, models.LanguageJapanese, tt.rules)
+		if err != nil {
+			t.Fatalf("%s: failed to create smart group: %v", tt.name, err)
+		}
+		if group.Kind != GroupKindSmart || group.Stats.TotalWordCount != len(tt.want) {
+			t.Errorf("%s: got %+v; want a smart group of %d words", tt.name, group, len(tt.want))
+		}
+		smartGroupID = group.ID
+		got := terms(group.ID)
+		for _, term := range tt.want {
+			if !got[term] {
+				t.Errorf("%s: expected %s in %v", tt.name, term, got)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Smart groups can be studied like any other group
+	signer, err := NewSessionTokenSigner([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create token signer: %v", err)
+	}
+	if _, err := NewStudyActivitiesService(db, signer).CreateStudySession(smartGroupID, 1); err != nil {
+		t.Errorf("Failed to start a session on a smart group: %v", err)
+	}
+
+	invalid := [][]models.GroupRule{
+		{{Type: "spelling"}},
+		{{Type: RuleAccuracyBelow, Value: 120}},
+		{{Type: RuleInGroup, GroupID: 99}},
+		{{Type: RuleInGroup, GroupID: smartGroupID}},
+	}
+	for _, rules := range invalid {
+		if _, err := groups.CreateSmartGroup("invalid", models.LanguageJapanese, rules); err == nil {
+			t.Errorf("Expected rules %+v to be rejected", rules)
+		}
+	}
+}
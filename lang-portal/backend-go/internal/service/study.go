@@ -3,6 +3,7 @@ package service
 import (
 	"time"
 
+	"lang-portal/internal/events"
 	"lang-portal/internal/models"
 )
 
@@ -14,6 +15,14 @@ func NewStudyService(db *models.DB) *StudyService {
 	return &StudyService{db: db}
 }
 
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *StudyService) labeled(method string) *StudyService {
+	c := *s
+	c.db = s.db.Labeled("StudyService." + method)
+	return &c
+}
+
 type StudyActivity struct {
 	ID           int    `json:"id"`
 	Name         string `json:"name"`
@@ -39,10 +48,11 @@ type PaginatedResponse struct {
 }
 
 func (s *StudyService) GetActivity(id int) (*StudyActivity, error) {
+	s = s.labeled("GetActivity")
 	query := `
 		SELECT id, name, thumbnail_url, description
 		FROM study_activities
-		WHERE id = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`
 	
 	var activity StudyActivity
@@ -59,6 +69,7 @@ func (s *StudyService) GetActivity(id int) (*StudyActivity, error) {
 }
 
 func (s *StudyService) GetActivitySessions(activityID, page int) (*PaginatedResponse, error) {
+	s = s.labeled("GetActivitySessions")
 	const itemsPerPage = 100
 	offset := (page - 1) * itemsPerPage
 
@@ -73,8 +84,8 @@ func (s *StudyService) GetActivitySessions(activityID, page int) (*PaginatedResp
 		FROM study_sessions ss
 		JOIN study_activities sa ON ss.study_activity_id = sa.id
 		JOIN groups g ON ss.group_id = g.id
-		LEFT JOIN word_review_items wri ON ss.id = wri.study_session_id
-		WHERE sa.id = ?
+		LEFT JOIN word_review_items wri ON ss.id = wri.study_session_id AND wri.deleted_at IS NULL
+		WHERE sa.id = ? AND ss.deleted_at IS NULL
 		GROUP BY ss.id
 		ORDER BY ss.created_at DESC
 		LIMIT ? OFFSET ?
@@ -83,7 +94,7 @@ func (s *StudyService) GetActivitySessions(activityID, page int) (*PaginatedResp
 	countQuery := `
 		SELECT COUNT(DISTINCT ss.id)
 		FROM study_sessions ss
-		WHERE ss.study_activity_id = ?
+		WHERE ss.study_activity_id = ? AND ss.deleted_at IS NULL
 	`
 
 	rows, err := s.db.Query(query, activityID, itemsPerPage, offset)
@@ -125,6 +136,7 @@ func (s *StudyService) GetActivitySessions(activityID, page int) (*PaginatedResp
 }
 
 func (s *StudyService) CreateStudySession(groupID, activityID int) (*models.StudySession, error) {
+	s = s.labeled("CreateStudySession")
 	query := `
 		INSERT INTO study_sessions (group_id, study_activity_id, created_at)
 		VALUES (?, ?, CURRENT_TIMESTAMP)
@@ -141,5 +153,10 @@ func (s *StudyService) CreateStudySession(groupID, activityID int) (*models.Stud
 	if err != nil {
 		return nil, err
 	}
+	events.Publish(s.db.Context(), events.SessionStarted, map[string]interface{}{
+		"study_session_id":  session.ID,
+		"group_id":          session.GroupID,
+		"study_activity_id": session.StudyActivityID,
+	})
 	return &session, nil
 }
\ No newline at end of file
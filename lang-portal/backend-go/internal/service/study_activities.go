@@ -1,24 +1,47 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"lang-portal/internal/events"
+	"lang-portal/internal/logging"
+	"lang-portal/internal/metrics"
 	"lang-portal/internal/models"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type StudyActivitiesService struct {
-	db *models.DB
+	db     *models.DB
+	tokens *SessionTokenSigner
 }
 
-func NewStudyActivitiesService(db *models.DB) *StudyActivitiesService {
-	return &StudyActivitiesService{db: db}
+func NewStudyActivitiesService(db *models.DB, tokens *SessionTokenSigner) *StudyActivitiesService {
+	return &StudyActivitiesService{db: db, tokens: tokens}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *StudyActivitiesService) WithContext(ctx context.Context) *StudyActivitiesService {
+	return &StudyActivitiesService{db: s.db.WithContext(ctx), tokens: s.tokens}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *StudyActivitiesService) labeled(method string) *StudyActivitiesService {
+	c := *s
+	c.db = s.db.Labeled("StudyActivitiesService." + method)
+	return &c
 }
 
 func (s *StudyActivitiesService) GetStudyActivity(id int) (*models.StudyActivity, error) {
+	s = s.labeled("GetStudyActivity")
 	query := `
-		SELECT id, name, thumbnail_url, description
+		SELECT id, name, thumbnail_url, description, COALESCE(launch_url, '')
 		FROM study_activities
-		WHERE id = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	var activity models.StudyActivity
@@ -27,6 +50,7 @@ func (s *StudyActivitiesService) GetStudyActivity(id int) (*models.StudyActivity
 		&activity.Name,
 		&activity.ThumbnailURL,
 		&activity.Description,
+		&activity.LaunchURL,
 	)
 	if err != nil {
 		return nil, err
@@ -35,6 +59,7 @@ func (s *StudyActivitiesService) GetStudyActivity(id int) (*models.StudyActivity
 }
 
 func (s *StudyActivitiesService) GetStudyActivitySessions(activityID, page int) ([]models.StudyActivitySessionResponse, *models.Pagination, error) {
+	s = s.labeled("GetStudyActivitySessions")
 	itemsPerPage := 100
 	offset := (page - 1) * itemsPerPage
 
@@ -45,7 +70,7 @@ func (s *StudyActivitiesService) GetStudyActivitySessions(activityID, page int)
 		FROM study_sessions ss
 		JOIN groups g ON ss.group_id = g.id
 		JOIN study_activities sa ON ss.study_activity_id = sa.id
-		WHERE ss.study_activity_id = ?
+		WHERE ss.study_activity_id = ? AND ss.deleted_at IS NULL
 	`
 	if err := s.db.QueryRow(countQuery, activityID).Scan(&totalItems); err != nil {
 		return nil, nil, err
@@ -59,7 +84,7 @@ func (s *StudyActivitiesService) GetStudyActivitySessions(activityID, page int)
 			strftime('%Y-%m-%d %H:%M:%S', ss.created_at) as created_at,
 			ss.study_activity_id
 		FROM study_sessions ss
-		WHERE ss.study_activity_id = ?
+		WHERE ss.study_activity_id = ? AND ss.deleted_at IS NULL
 		ORDER BY ss.created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -104,7 +129,8 @@ func (s *StudyActivitiesService) GetStudyActivitySessions(activityID, page int)
 	return sessions, pagination, nil
 }
 
-func (s *StudyActivitiesService) CreateStudySession(groupID, activityID int) (*models.StudySession, error) {
+func (s *StudyActivitiesService) CreateStudySession(groupID, activityID int) (*models.StudySessionLaunchResponse, error) {
+	s = s.labeled("CreateStudySession")
 	// Verify group and activity exist
 	if err := s.verifyGroupAndActivity(groupID, activityID); err != nil {
 		return nil, err
@@ -116,7 +142,7 @@ func (s *StudyActivitiesService) CreateStudySession(groupID, activityID int) (*m
 		RETURNING id, group_id, created_at, study_activity_id
 	`
 
-	var session models.StudySession
+	var session models.StudySessionLaunchResponse
 	err := s.db.QueryRow(query, groupID, activityID).Scan(
 		&session.ID,
 		&session.GroupID,
@@ -127,22 +153,110 @@ func (s *StudyActivitiesService) CreateStudySession(groupID, activityID int) (*m
 		return nil, err
 	}
 
+	var launchTemplate string
+	if err := s.db.QueryRow("SELECT COALESCE(launch_url, '') FROM study_activities WHERE id = ?", activityID).Scan(&launchTemplate); err != nil {
+		return nil, err
+	}
+
+	metrics.SessionsCreated.Inc()
+	logging.FromContext(s.db.Context()).Info("study session created",
+		"study_session_id", session.ID, "group_id", groupID, "study_activity_id", activityID)
+
+	events.Publish(s.db.Context(), events.SessionStarted, map[string]interface{}{
+		"study_session_id":  session.ID,
+		"group_id":          session.GroupID,
+		"study_activity_id": session.StudyActivityID,
+	})
+	publishStreakExtended(s.db)
+
+	session.SessionToken, session.TokenExpiresAt = s.tokens.Sign(session.ID, session.GroupID)
+	session.LaunchURL, err = buildLaunchURL(launchTemplate, session.ID, session.GroupID, session.StudyActivityID, session.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
 	return &session, nil
 }
 
+// buildLaunchURL expands the {session_id}, {group_id}, {study_activity_id}
+// and {token} placeholders of an activity's launch URL template. Session,
+// group and token values missing from the template are appended as query
+// parameters so the launched app always receives them.
+func buildLaunchURL(template string, sessionID, groupID, activityID int, token string) (string, error) {
+	if template == "" {
+		return "", nil
+	}
+
+	values := map[string]string{
+		"session_id":        strconv.Itoa(sessionID),
+		"group_id":          strconv.Itoa(groupID),
+		"study_activity_id": strconv.Itoa(activityID),
+		"token":             token,
+	}
+
+	expanded := template
+	for key, value := range values {
+		expanded = strings.ReplaceAll(expanded, "{"+key+"}", url.QueryEscape(value))
+	}
+
+	launchURL, err := url.Parse(expanded)
+	if err != nil {
+		return "", fmt.Errorf("invalid launch URL template %q: %v", template, err)
+	}
+
+	query := launchURL.Query()
+	for _, key := range []string{"session_id", "group_id", "token"} {
+		if !strings.Contains(template, "{"+key+"}") {
+			query.Set(key, values[key])
+		}
+	}
+	launchURL.RawQuery = query.Encode()
+
+	return launchURL.String(), nil
+}
+
+// DeleteStudyActivity moves a study activity to the trash. Activities with
+// study sessions keep their history, so they cannot be deleted.
+func (s *StudyActivitiesService) DeleteStudyActivity(id int) error {
+	s = s.labeled("DeleteStudyActivity")
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_activities WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	var studied bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_sessions WHERE study_activity_id = ? AND deleted_at IS NULL)", id).Scan(&studied); err != nil {
+		return err
+	}
+	if studied {
+		return fmt.Errorf("study activity %d has study sessions and cannot be deleted", id)
+	}
+
+	_, err := s.db.Exec("UPDATE study_activities SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
+
 func (s *StudyActivitiesService) verifyGroupAndActivity(groupID, activityID int) error {
 	// Check if group exists
 	var groupExists bool
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = ?)", groupID).Scan(&groupExists); err != nil {
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = ? AND deleted_at IS NULL)", groupID).Scan(&groupExists); err != nil {
 		return err
 	}
 	if !groupExists {
 		return fmt.Errorf("group with ID %d does not exist", groupID)
 	}
 
+	// Smart groups must resolve to be studied
+	if _, _, err := groupWordsCondition(s.db, groupID); err != nil {
+		return err
+	}
+
 	// Check if activity exists
 	var activityExists bool
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_activities WHERE id = ?)", activityID).Scan(&activityExists); err != nil {
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_activities WHERE id = ? AND deleted_at IS NULL)", activityID).Scan(&activityExists); err != nil {
 		return err
 	}
 	if !activityExists {
@@ -150,4 +264,57 @@ func (s *StudyActivitiesService) verifyGroupAndActivity(groupID, activityID int)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// publishStreakExtended announces the study streak when the session just
+// created is the first of the learner's local day and continues the streak of
+// yesterday. Errors are only logged, as the session has been created.
+func publishStreakExtended(db *models.DB) {
+	logger := logging.FromContext(db.Context())
+	location, err := loadUserLocation(db)
+	if err != nil {
+		logger.Error("failed to check study streak", "error", err)
+		return
+	}
+
+	// Sessions are bucketed into local days with today's offset, newest first,
+	// so the streak is read until its first gap
+	today := time.Now().In(location)
+	_, offset := today.Zone()
+	rows, err := db.Query(`
+		SELECT date(created_at, ?) AS day, COUNT(*)
+		FROM study_sessions
+		WHERE deleted_at IS NULL
+		GROUP BY day
+		ORDER BY day DESC
+	`, fmt.Sprintf("%+d seconds", offset))
+	if err != nil {
+		logger.Error("failed to check study streak", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	streak := 0
+	for day := today; rows.Next(); day = day.AddDate(0, 0, -1) {
+		var date string
+		var sessions int
+		if err := rows.Scan(&date, &sessions); err != nil {
+			logger.Error("failed to check study streak", "error", err)
+			return
+		}
+		if date != day.Format(dateLayout) || (streak == 0 && sessions != 1) {
+			break
+		}
+		streak++
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to check study streak", "error", err)
+		return
+	}
+	if streak > 1 {
+		events.Publish(db.Context(), events.StreakExtended, map[string]interface{}{
+			"streak_days": streak,
+			"date":        today.Format(dateLayout),
+		})
+	}
+}
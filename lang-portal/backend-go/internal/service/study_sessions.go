@@ -1,26 +1,46 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"lang-portal/internal/events"
+	"lang-portal/internal/logging"
+	"lang-portal/internal/metrics"
 	"lang-portal/internal/models"
 	"time"
 )
 
 type StudySessionsService struct {
-	db *models.DB
+	db     *models.DB
+	tokens *SessionTokenSigner
 }
 
-func NewStudySessionsService(db *models.DB) *StudySessionsService {
-	return &StudySessionsService{db: db}
+func NewStudySessionsService(db *models.DB, tokens *SessionTokenSigner) *StudySessionsService {
+	return &StudySessionsService{db: db, tokens: tokens}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *StudySessionsService) WithContext(ctx context.Context) *StudySessionsService {
+	return &StudySessionsService{db: s.db.WithContext(ctx), tokens: s.tokens}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *StudySessionsService) labeled(method string) *StudySessionsService {
+	c := *s
+	c.db = s.db.Labeled("StudySessionsService." + method)
+	return &c
 }
 
 func (s *StudySessionsService) GetStudySessions(page int) ([]models.StudySessionResponse, *models.Pagination, error) {
+	s = s.labeled("GetStudySessions")
 	itemsPerPage := 100
 	offset := (page - 1) * itemsPerPage
 
 	// Get total count
 	var totalItems int
-	countQuery := `SELECT COUNT(*) FROM study_sessions`
+	countQuery := `SELECT COUNT(*) FROM study_sessions WHERE deleted_at IS NULL`
 	if err := s.db.QueryRow(countQuery).Scan(&totalItems); err != nil {
 		return nil, nil, err
 	}
@@ -33,10 +53,11 @@ func (s *StudySessionsService) GetStudySessions(page int) ([]models.StudySession
 			g.name as group_name,
 			strftime('%Y-%m-%d %H:%M:%S', ss.created_at) as start_time,
 			strftime('%Y-%m-%d %H:%M:%S', datetime(ss.created_at, '+10 minutes')) as end_time,
-			(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id) as review_items_count
+			(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id AND deleted_at IS NULL) as review_items_count
 		FROM study_sessions ss
 		JOIN groups g ON ss.group_id = g.id
 		JOIN study_activities sa ON ss.study_activity_id = sa.id
+		WHERE ss.deleted_at IS NULL
 		ORDER BY ss.created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -90,6 +111,7 @@ func (s *StudySessionsService) GetStudySessions(page int) ([]models.StudySession
 }
 
 func (s *StudySessionsService) GetStudySession(id int) (*models.StudySessionResponse, error) {
+	s = s.labeled("GetStudySession")
 	query := `
 		SELECT 
 			ss.id,
@@ -97,11 +119,11 @@ func (s *StudySessionsService) GetStudySession(id int) (*models.StudySessionResp
 			g.name as group_name,
 			strftime('%Y-%m-%d %H:%M:%S', ss.created_at) as start_time,
 			strftime('%Y-%m-%d %H:%M:%S', datetime(ss.created_at, '+10 minutes')) as end_time,
-			(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id) as review_items_count
+			(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id AND deleted_at IS NULL) as review_items_count
 		FROM study_sessions ss
 		JOIN groups g ON ss.group_id = g.id
 		JOIN study_activities sa ON ss.study_activity_id = sa.id
-		WHERE ss.id = ?
+		WHERE ss.id = ? AND ss.deleted_at IS NULL
 	`
 
 	var session models.StudySessionResponse
@@ -136,6 +158,7 @@ func (s *StudySessionsService) GetStudySession(id int) (*models.StudySessionResp
 }
 
 func (s *StudySessionsService) GetStudySessionWords(sessionID, page int) ([]models.WordWithStats, *models.Pagination, error) {
+	s = s.labeled("GetStudySessionWords")
 	itemsPerPage := 100
 	offset := (page - 1) * itemsPerPage
 
@@ -144,7 +167,7 @@ func (s *StudySessionsService) GetStudySessionWords(sessionID, page int) ([]mode
 	countQuery := `
 		SELECT COUNT(DISTINCT wri.word_id)
 		FROM word_review_items wri
-		WHERE wri.study_session_id = ?
+		WHERE wri.study_session_id = ? AND wri.deleted_at IS NULL
 	`
 	if err := s.db.QueryRow(countQuery, sessionID).Scan(&totalItems); err != nil {
 		return nil, nil, err
@@ -153,9 +176,11 @@ func (s *StudySessionsService) GetStudySessionWords(sessionID, page int) ([]mode
 	// Get words with stats
 	query := `
 		SELECT 
-			w.japanese,
-			w.romaji,
-			w.english,
+			w.id,
+			w.language,
+			w.term,
+			w.transliteration,
+			w.meaning,
 			(SELECT COUNT(*) FROM word_review_items wri2 
 				WHERE wri2.word_id = w.id 
 				AND wri2.study_session_id = ? 
@@ -166,9 +191,9 @@ func (s *StudySessionsService) GetStudySessionWords(sessionID, page int) ([]mode
 				AND wri2.correct = 0) as wrong_count
 		FROM word_review_items wri
 		JOIN words w ON wri.word_id = w.id
-		WHERE wri.study_session_id = ?
+		WHERE wri.study_session_id = ? AND wri.deleted_at IS NULL
 		GROUP BY w.id
-		ORDER BY w.japanese
+		ORDER BY w.term
 		LIMIT ? OFFSET ?
 	`
 
@@ -182,17 +207,24 @@ func (s *StudySessionsService) GetStudySessionWords(sessionID, page int) ([]mode
 	for rows.Next() {
 		var word models.WordWithStats
 		if err := rows.Scan(
-			&word.Japanese,
-			&word.Romaji,
-			&word.English,
+			&word.ID,
+			&word.Language,
+			&word.Term,
+			&word.Transliteration,
+			&word.Meaning,
 			&word.CorrectCount,
 			&word.WrongCount,
 		); err != nil {
 			return nil, nil, err
 		}
+		word.LegacyWordFields = models.NewLegacyWordFields(word.Language, word.Term, word.Transliteration, word.Meaning)
 		words = append(words, word)
 	}
 
+	if err := fillWordDetails(s.db, words); err != nil {
+		return nil, nil, err
+	}
+
 	pagination := &models.Pagination{
 		CurrentPage:  page,
 		TotalPages:  (totalItems + itemsPerPage - 1) / itemsPerPage,
@@ -204,62 +236,226 @@ func (s *StudySessionsService) GetStudySessionWords(sessionID, page int) ([]mode
 }
 
 func (s *StudySessionsService) ReviewWord(sessionID, wordID int, correct bool) error {
-	// Verify session exists
-	var sessionExists bool
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_sessions WHERE id = ?)", sessionID).Scan(&sessionExists); err != nil {
+	s = s.labeled("ReviewWord")
+	return s.ReviewWordTimed(sessionID, wordID, correct, 0)
+}
+
+// ReviewWordTimed records a review with the time the learner took to answer.
+// A responseTimeMs of 0 means the time is not known.
+func (s *StudySessionsService) ReviewWordTimed(sessionID, wordID int, correct bool, responseTimeMs int) error {
+	s = s.labeled("ReviewWordTimed")
+	if responseTimeMs < 0 {
+		return fmt.Errorf("invalid response time %d", responseTimeMs)
+	}
+	if err := s.CheckReviewTarget(sessionID, wordID); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(insertReview, wordID, sessionID, correct, responseTimeMs); err != nil {
+		return err
+	}
+	refreshTroubleWordsAfter(s.db, "w.id = ?", wordID)
+	s.reviewRecorded(sessionID, wordID, correct, responseTimeMs)
+	s.completeIfCovered(sessionID, wordID)
+	return nil
+}
+
+// completeIfCovered publishes session.completed when the review of wordID
+// was its first in the session and the session's reviews now cover every
+// word of its group. Reviews outside a quiz have nothing to grade, so
+// covering the group is what finishes such a session.
+func (s *StudySessionsService) completeIfCovered(sessionID, wordID int) {
+	if err := s.publishIfCovered(sessionID, wordID); err != nil {
+		logging.FromContext(s.db.Context()).Error("failed to check session completion",
+			"study_session_id", sessionID, "error", err)
+	}
+}
+
+func (s *StudySessionsService) publishIfCovered(sessionID, wordID int) error {
+	var groupID, wordReviews int
+	if err := s.db.QueryRow(`
+		SELECT ss.group_id,
+			(SELECT COUNT(*) FROM word_review_items
+			WHERE study_session_id = ss.id AND word_id = ? AND deleted_at IS NULL)
+		FROM study_sessions ss WHERE ss.id = ?
+	`, wordID, sessionID).Scan(&groupID, &wordReviews); err != nil {
 		return err
 	}
-	if !sessionExists {
+	if wordReviews != 1 {
+		return nil
+	}
+
+	condition, args, err := groupWordsCondition(s.db, groupID)
+	if err == sql.ErrNoRows {
+		// The group was deleted, so there is nothing left to cover
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var groupWords, unreviewed int
+	if err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(w.id NOT IN (
+			SELECT word_id FROM word_review_items WHERE study_session_id = ? AND deleted_at IS NULL
+		)), 0)
+		FROM words w WHERE `+condition, append([]interface{}{sessionID}, args...)...).Scan(&groupWords, &unreviewed); err != nil {
+		return err
+	}
+	if groupWords == 0 || unreviewed > 0 {
+		return nil
+	}
+
+	var correctCount, totalCount int
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(correct), 0), COUNT(*) FROM word_review_items
+		WHERE study_session_id = ? AND deleted_at IS NULL
+	`, sessionID).Scan(&correctCount, &totalCount); err != nil {
+		return err
+	}
+	events.Publish(s.db.Context(), events.SessionCompleted, map[string]interface{}{
+		"study_session_id": sessionID,
+		"correct_count":    correctCount,
+		"total_count":      totalCount,
+		"score":            float64(correctCount) / float64(totalCount) * 100,
+	})
+	return nil
+}
+
+// insertReview records a review of a word, with its session, whether the
+// answer was correct and the response time, or 0 when it is not known
+const insertReview = `
+	INSERT INTO word_review_items (word_id, study_session_id, correct, response_time_ms, created_at)
+	VALUES (?, ?, ?, NULLIF(?, 0), CURRENT_TIMESTAMP)
+`
+
+// reviewRecorded counts, logs and publishes a review once it is stored
+func (s *StudySessionsService) reviewRecorded(sessionID, wordID int, correct bool, responseTimeMs int) {
+	metrics.RecordReview(correct)
+	logging.FromContext(s.db.Context()).Info("review recorded",
+		"study_session_id", sessionID, "word_id", wordID, "correct", correct)
+
+	data := map[string]interface{}{
+		"study_session_id": sessionID,
+		"word_id":          wordID,
+		"correct":          correct,
+	}
+	if responseTimeMs > 0 {
+		data["response_time_ms"] = responseTimeMs
+	}
+	events.Publish(s.db.Context(), events.ReviewRecorded, data)
+}
+
+// CheckStudySession returns an error when the study session does not exist
+func (s *StudySessionsService) CheckStudySession(sessionID int) error {
+	s = s.labeled("CheckStudySession")
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM study_sessions WHERE id = ? AND deleted_at IS NULL)", sessionID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
 		return fmt.Errorf("study session with ID %d does not exist", sessionID)
 	}
+	return nil
+}
 
-	// Verify word exists
-	var wordExists bool
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM words WHERE id = ?)", wordID).Scan(&wordExists); err != nil {
+// CheckReviewTarget returns an error when the study session or the word of a
+// review does not exist
+func (s *StudySessionsService) CheckReviewTarget(sessionID, wordID int) error {
+	s = s.labeled("CheckReviewTarget")
+	if err := s.CheckStudySession(sessionID); err != nil {
 		return err
 	}
-	if !wordExists {
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM words WHERE id = ? AND deleted_at IS NULL)", wordID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
 		return fmt.Errorf("word with ID %d does not exist", wordID)
 	}
+	return nil
+}
 
-	// Insert review
-	query := `
-		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at)
-		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
-	`
+// VerifySessionToken checks a token issued when the session was launched
+func (s *StudySessionsService) VerifySessionToken(sessionID int, token string) error {
+	return s.tokens.Verify(token, sessionID)
+}
 
-	if _, err := s.db.Exec(query, wordID, sessionID, correct); err != nil {
+// DeleteStudySession moves a study session and its reviews to the trash
+func (s *StudySessionsService) DeleteStudySession(id int) error {
+	s = s.labeled("DeleteStudySession")
+	tx, err := s.db.Begin()
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE study_sessions SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("UPDATE word_review_items SET deleted_at = CURRENT_TIMESTAMP WHERE study_session_id = ?", id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logging.FromContext(s.db.Context()).Info("study session deleted", "study_session_id", id)
 
+	// Without the reviews of the session its words may no longer be trouble words
+	refreshTroubleWordsAfter(s.db, "w.id IN (SELECT word_id FROM word_review_items WHERE study_session_id = ?)", id)
 	return nil
 }
 
+// ResetHistory archives every review and study session. Archived history is
+// kept in the database but no longer counts anywhere, and is not purged with
+// the trash.
 func (s *StudySessionsService) ResetHistory() error {
+	s = s.labeled("ResetHistory")
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Delete all word review items
-	if _, err := tx.Exec("DELETE FROM word_review_items"); err != nil {
+	// Archive all word review items
+	if _, err := tx.Exec(`
+		UPDATE word_review_items
+		SET deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), archived_at = CURRENT_TIMESTAMP
+		WHERE archived_at IS NULL
+	`); err != nil {
+		return err
+	}
+
+	// Archive all study sessions, including those in the trash
+	if _, err := tx.Exec(`
+		UPDATE study_sessions
+		SET deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), archived_at = CURRENT_TIMESTAMP
+		WHERE archived_at IS NULL
+	`); err != nil {
 		return err
 	}
 
-	// Delete all study sessions
-	if _, err := tx.Exec("DELETE FROM study_sessions"); err != nil {
+	// Without history there are no leeches
+	if _, err := tx.Exec("DELETE FROM words_groups WHERE group_id IN (SELECT id FROM groups WHERE kind = ?)", GroupKindLeeches); err != nil {
 		return err
 	}
 
 	if err := tx.Commit(); err != nil {
 		return err
 	}
+	logging.FromContext(s.db.Context()).Warn("study history reset")
+	events.PublishShared(events.HistoryReset, nil)
 
 	return nil
 }
 
 func (s *StudySessionsService) FullReset() error {
+	s = s.labeled("FullReset")
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -271,6 +467,7 @@ func (s *StudySessionsService) FullReset() error {
 		"word_review_items",
 		"study_sessions",
 		"words_groups",
+		"example_sentences",
 		"words",
 		"groups",
 		"study_activities",
@@ -285,7 +482,7 @@ func (s *StudySessionsService) FullReset() error {
 	// Insert test data
 	// Insert words with specific IDs
 	wordQuery := `
-		INSERT INTO words (id, japanese, romaji, english) VALUES
+		INSERT INTO words (id, term, transliteration, meaning) VALUES
 		(1, '犬', 'inu', 'dog'),
 		(2, '猫', 'neko', 'cat'),
 		(3, '鳥', 'tori', 'bird')
@@ -296,9 +493,10 @@ func (s *StudySessionsService) FullReset() error {
 
 	// Insert groups with specific IDs
 	groupQuery := `
-		INSERT INTO groups (id, name) VALUES
-		(1, 'Animals'),
-		(2, 'Basic Words')
+		INSERT INTO groups (id, name, kind) VALUES
+		(1, 'Animals', 'static'),
+		(2, 'Basic Words', 'static'),
+		(3, 'Trouble words', 'leeches')
 	`
 	if _, err := tx.Exec(groupQuery); err != nil {
 		return err
@@ -306,9 +504,9 @@ func (s *StudySessionsService) FullReset() error {
 
 	// Insert study activities with specific IDs
 	studyActivitiesQuery := `
-		INSERT INTO study_activities (id, name, thumbnail_url, description) VALUES
-		(1, 'Flashcards', 'https://example.com/flashcards.png', 'Practice with flashcards'),
-		(2, 'Multiple Choice', 'https://example.com/quiz.png', 'Test your knowledge with multiple choice questions')
+		INSERT INTO study_activities (id, name, thumbnail_url, description, launch_url) VALUES
+		(1, 'Flashcards', 'https://example.com/flashcards.png', 'Practice with flashcards', 'http://localhost:8080/flashcards?session_id={session_id}&group_id={group_id}&token={token}'),
+		(2, 'Multiple Choice', 'https://example.com/quiz.png', 'Test your knowledge with multiple choice questions', 'http://localhost:8080/quiz?session_id={session_id}&group_id={group_id}&token={token}')
 	`
 	if _, err := tx.Exec(studyActivitiesQuery); err != nil {
 		return err
@@ -328,6 +526,8 @@ func (s *StudySessionsService) FullReset() error {
 	if err := tx.Commit(); err != nil {
 		return err
 	}
+	logging.FromContext(s.db.Context()).Warn("database reset to seed data")
+	events.PublishShared(events.DataReset, nil)
 
 	return nil
 }
\ No newline at end of file
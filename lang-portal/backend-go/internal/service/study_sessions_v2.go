@@ -0,0 +1,106 @@
+package service
+
+import (
+	"database/sql"
+
+	"lang-portal/internal/models"
+)
+
+const studySessionColumns = `
+	ss.id,
+	ss.group_id,
+	g.name,
+	ss.study_activity_id,
+	sa.name,
+	ss.created_at,
+	(SELECT MAX(created_at) FROM word_review_items WHERE study_session_id = ss.id AND deleted_at IS NULL),
+	(SELECT COUNT(*) FROM word_review_items WHERE study_session_id = ss.id AND deleted_at IS NULL)
+`
+
+// ListStudySessions lists sessions newest first, ending at their last review
+// rather than at a made up time. A zero groupID or activityID does not filter.
+func (s *StudySessionsService) ListStudySessions(groupID, activityID, page int) ([]models.StudySessionDetails, *models.Pagination, error) {
+	s = s.labeled("ListStudySessions")
+	itemsPerPage := 100
+	offset := (page - 1) * itemsPerPage
+
+	condition := `(? = 0 OR ss.group_id = ?) AND (? = 0 OR ss.study_activity_id = ?) AND ss.deleted_at IS NULL`
+	args := []interface{}{groupID, groupID, activityID, activityID}
+
+	var totalItems int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM study_sessions ss WHERE `+condition, args...).Scan(&totalItems); err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+		SELECT ` + studySessionColumns + `
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		JOIN study_activities sa ON ss.study_activity_id = sa.id
+		WHERE ` + condition + `
+		ORDER BY ss.created_at DESC, ss.id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.db.Query(query, append(args, itemsPerPage, offset)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.StudySessionDetails, 0)
+	for rows.Next() {
+		session, err := scanStudySession(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	pagination := &models.Pagination{
+		CurrentPage:  page,
+		TotalPages:   (totalItems + itemsPerPage - 1) / itemsPerPage,
+		TotalItems:   totalItems,
+		ItemsPerPage: itemsPerPage,
+	}
+	return sessions, pagination, nil
+}
+
+func (s *StudySessionsService) GetStudySessionByID(id int) (*models.StudySessionDetails, error) {
+	s = s.labeled("GetStudySessionByID")
+	query := `
+		SELECT ` + studySessionColumns + `
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		JOIN study_activities sa ON ss.study_activity_id = sa.id
+		WHERE ss.id = ? AND ss.deleted_at IS NULL
+	`
+	return scanStudySession(s.db.QueryRow(query, id))
+}
+
+func scanStudySession(row interface{ Scan(...interface{}) error }) (*models.StudySessionDetails, error) {
+	var session models.StudySessionDetails
+	var endedAt sql.NullString
+	if err := row.Scan(
+		&session.ID,
+		&session.GroupID,
+		&session.GroupName,
+		&session.StudyActivityID,
+		&session.ActivityName,
+		&session.StartedAt,
+		&endedAt,
+		&session.ReviewItemsCount,
+	); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		t, err := parseTimestamp(endedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		session.EndedAt = &t
+	}
+	return &session, nil
+}
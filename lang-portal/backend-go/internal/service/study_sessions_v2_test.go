@@ -0,0 +1,60 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+
+	"lang-portal/internal/testdb"
+)
+
+func TestListStudySessions(t *testing.T) {
+	db := testdb.New(t)
+
+	if _, err := db.Exec(`
+		INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES
+		(2, 2, datetime('now', '-1 hour'), 1);
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(1, 1, 1, datetime('now', '-1 day', '+2 minutes')),
+		(2, 1, 0, datetime('now', '-1 day', '+7 minutes'));
+	`); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	service := NewStudySessionsService(db, nil)
+
+	sessions, pagination, err := service.ListStudySessions(0, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if pagination.TotalItems != 2 || len(sessions) != 2 || sessions[0].ID != 2 {
+		t.Fatalf("Expected both sessions, newest first; got %+v", sessions)
+	}
+	if sessions[0].EndedAt != nil || sessions[0].ReviewItemsCount != 0 {
+		t.Errorf("Expected a session without reviews to have no end; got %+v", sessions[0])
+	}
+	reviewed := sessions[1]
+	if reviewed.EndedAt == nil || reviewed.ReviewItemsCount != 2 || reviewed.GroupName != "Animals" {
+		t.Fatalf("Unexpected session: %+v", reviewed)
+	}
+	if duration := reviewed.EndedAt.Sub(reviewed.StartedAt).Minutes(); duration != 7 {
+		t.Errorf("Expected the session to end at its last review; lasted %v minutes", duration)
+	}
+
+	sessions, _, err = service.ListStudySessions(2, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to list group sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].GroupID != 2 {
+		t.Errorf("Expected only the session of group 2; got %+v", sessions)
+	}
+
+	session, err := service.GetStudySessionByID(1)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session.ActivityName != "Flashcards" || session.EndedAt == nil {
+		t.Errorf("Unexpected session: %+v", session)
+	}
+	if _, err := service.GetStudySessionByID(99); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing session; got %v", err)
+	}
+}
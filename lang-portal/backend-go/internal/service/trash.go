@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/logging"
+	"lang-portal/internal/models"
+)
+
+// Types of the items in the trash
+const (
+	TrashWord          = "word"
+	TrashGroup         = "group"
+	TrashStudySession  = "study_session"
+	TrashStudyActivity = "study_activity"
+)
+
+// DefaultTrashRetention is how long deleted rows are kept before they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashItems lists what the trash holds. Archived study sessions are deleted
+// by resetting the history, not by the learner, so they are left out.
+const trashItems = `
+	SELECT 'word', id, term, deleted_at FROM words WHERE deleted_at IS NOT NULL
+	UNION ALL
+	SELECT 'group', id, name, deleted_at FROM groups WHERE deleted_at IS NOT NULL
+	UNION ALL
+	SELECT 'study_session', ss.id, g.name || ' (' || sa.name || ')', ss.deleted_at
+	FROM study_sessions ss
+	JOIN groups g ON ss.group_id = g.id
+	JOIN study_activities sa ON ss.study_activity_id = sa.id
+	WHERE ss.deleted_at IS NOT NULL AND ss.archived_at IS NULL
+	UNION ALL
+	SELECT 'study_activity', id, name, deleted_at FROM study_activities WHERE deleted_at IS NOT NULL
+`
+
+type TrashService struct {
+	db *models.DB
+}
+
+func NewTrashService(db *models.DB) *TrashService {
+	return &TrashService{db: db}
+}
+
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *TrashService) WithContext(ctx context.Context) *TrashService {
+	return &TrashService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *TrashService) labeled(method string) *TrashService {
+	c := *s
+	c.db = s.db.Labeled("TrashService." + method)
+	return &c
+}
+
+// GetTrash lists the deleted items, most recently deleted first
+func (s *TrashService) GetTrash(page int) ([]models.TrashItem, *models.Pagination, error) {
+	s = s.labeled("GetTrash")
+	itemsPerPage := 100
+	offset := (page - 1) * itemsPerPage
+
+	var totalItems int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM (` + trashItems + `)`).Scan(&totalItems); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT * FROM (`+trashItems+`)
+		ORDER BY 4 DESC, 1, 2 DESC
+		LIMIT ? OFFSET ?
+	`, itemsPerPage, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.TrashItem, 0)
+	for rows.Next() {
+		var item models.TrashItem
+		var deletedAt string
+		if err := rows.Scan(&item.Type, &item.ID, &item.Name, &deletedAt); err != nil {
+			return nil, nil, err
+		}
+		if item.DeletedAt, err = parseTimestamp(deletedAt); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	pagination := &models.Pagination{
+		CurrentPage:  page,
+		TotalPages:   (totalItems + itemsPerPage - 1) / itemsPerPage,
+		TotalItems:   totalItems,
+		ItemsPerPage: itemsPerPage,
+	}
+	return items, pagination, nil
+}
+
+// Restore takes an item out of the trash. Restoring a word or a study session
+// also restores the reviews that are not held back by the other of the two.
+func (s *TrashService) Restore(itemType string, id int) error {
+	s = s.labeled("Restore")
+	switch itemType {
+	case TrashWord:
+		return s.restoreWord(id)
+	case TrashGroup:
+		if err := s.restore("groups", id); err != nil {
+			return err
+		}
+		events.PublishShared(events.GroupCreated, map[string]interface{}{"id": id})
+		return nil
+	case TrashStudySession:
+		return s.restoreStudySession(id)
+	case TrashStudyActivity:
+		return s.restore("study_activities", id)
+	default:
+		return fmt.Errorf("invalid trash item type %q", itemType)
+	}
+}
+
+// restore clears deleted_at of a row of table, or returns sql.ErrNoRows when
+// the row is not in the trash
+func (s *TrashService) restore(table string, id int) error {
+	result, err := s.db.Exec("UPDATE "+table+" SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *TrashService) restoreWord(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE words SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`
+		UPDATE word_review_items SET deleted_at = NULL
+		WHERE word_id = ? AND archived_at IS NULL
+		AND study_session_id IN (SELECT id FROM study_sessions WHERE deleted_at IS NULL)
+	`, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	refreshTroubleWordsAfter(s.db, "w.id = ?", id)
+	events.PublishShared(events.WordUpdated, map[string]interface{}{"id": id})
+	return nil
+}
+
+func (s *TrashService) restoreStudySession(id int) error {
+	var groupDeleted, activityDeleted bool
+	if err := s.db.QueryRow(`
+		SELECT g.deleted_at IS NOT NULL, sa.deleted_at IS NOT NULL
+		FROM study_sessions ss
+		JOIN groups g ON ss.group_id = g.id
+		JOIN study_activities sa ON ss.study_activity_id = sa.id
+		WHERE ss.id = ? AND ss.deleted_at IS NOT NULL AND ss.archived_at IS NULL
+	`, id).Scan(&groupDeleted, &activityDeleted); err != nil {
+		return err
+	}
+	if groupDeleted {
+		return fmt.Errorf("study session %d belongs to a deleted group and cannot be restored", id)
+	}
+	if activityDeleted {
+		return fmt.Errorf("study session %d belongs to a deleted study activity and cannot be restored", id)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE study_sessions SET deleted_at = NULL WHERE id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE word_review_items SET deleted_at = NULL
+		WHERE study_session_id = ? AND archived_at IS NULL
+		AND word_id IN (SELECT id FROM words WHERE deleted_at IS NULL)
+	`, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	refreshTroubleWordsAfter(s.db, "w.id IN (SELECT word_id FROM word_review_items WHERE study_session_id = ?)", id)
+	return nil
+}
+
+// Purge deletes for good the rows that went to the trash before cutoff. The
+// sessions of purged groups and activities, archived or not, go with them.
+// It returns the number of words, groups, study sessions and study
+// activities purged.
+func (s *TrashService) Purge(cutoff time.Time) (int, error) {
+	s = s.labeled("Purge")
+	at := sqliteTime(cutoff)
+	words := `SELECT id FROM words WHERE deleted_at < ?`
+	groups := `SELECT id FROM groups WHERE deleted_at < ?`
+	activities := `SELECT id FROM study_activities WHERE deleted_at < ?`
+	sessions := `
+		SELECT id FROM study_sessions
+		WHERE (deleted_at < ? AND archived_at IS NULL)
+		OR group_id IN (` + groups + `) OR study_activity_id IN (` + activities + `)
+	`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Rows are deleted before the rows they refer to
+	steps := []struct {
+		query   string
+		args    []interface{}
+		counted bool
+	}{
+		{`DELETE FROM word_review_items
+			WHERE (deleted_at < ? AND archived_at IS NULL)
+			OR word_id IN (` + words + `) OR study_session_id IN (` + sessions + `)`,
+			[]interface{}{at, at, at, at, at}, false},
+		{`DELETE FROM study_sessions WHERE id IN (` + sessions + `)`, []interface{}{at, at, at}, true},
+		{`DELETE FROM words_groups WHERE word_id IN (` + words + `) OR group_id IN (` + groups + `)`, []interface{}{at, at}, false},
+		{`DELETE FROM example_sentences WHERE word_id IN (` + words + `)`, []interface{}{at}, false},
+		{`DELETE FROM words WHERE deleted_at < ?`, []interface{}{at}, true},
+		{`DELETE FROM groups WHERE deleted_at < ?`, []interface{}{at}, true},
+		{`DELETE FROM study_activities WHERE deleted_at < ?`, []interface{}{at}, true},
+	}
+	purged := 0
+	for _, step := range steps {
+		result, err := tx.Exec(step.query, step.args...)
+		if err != nil {
+			return 0, err
+		}
+		if step.counted {
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+			purged += int(affected)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// RunPurge purges the rows kept in the trash for longer than retention every
+// interval until ctx is done
+func (s *TrashService) RunPurge(ctx context.Context, retention, interval time.Duration) {
+	s = s.labeled("RunPurge")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := s.WithContext(ctx).Purge(time.Now().Add(-retention))
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to purge the trash", "error", err)
+		} else if purged > 0 {
+			logging.FromContext(ctx).Info("trash purged", "items", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
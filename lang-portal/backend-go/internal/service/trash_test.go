@@ -0,0 +1,122 @@
+package service
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"lang-portal/internal/testdb"
+)
+
+func TestTrash(t *testing.T) {
+	db := testdb.New(t)
+	words := NewWordService(db)
+	groups := NewGroupsService(db)
+	sessions := NewStudySessionsService(db, nil)
+	trash := NewTrashService(db)
+
+	if err := sessions.ReviewWord(1, 2, true); err != nil {
+		t.Fatalf("Failed to review word: %v", err)
+	}
+	countReviews := func() int {
+		t.Helper()
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM word_review_items WHERE deleted_at IS NULL").Scan(&count); err != nil {
+			t.Fatalf("Failed to count reviews: %v", err)
+		}
+		return count
+	}
+
+	// Deleting a word hides it and its reviews
+	if err := words.DeleteWord(2); err != nil {
+		t.Fatalf("Failed to delete word: %v", err)
+	}
+	if _, err := words.GetWordByID(2); err != sql.ErrNoRows {
+		t.Errorf("Expected the deleted word to be gone; got %v", err)
+	}
+	if countReviews() != 0 {
+		t.Error("Expected the reviews of the word to be deleted")
+	}
+	if err := words.DeleteWord(2); err != sql.ErrNoRows {
+		t.Errorf("Expected deleting twice to fail; got %v", err)
+	}
+
+	if err := groups.DeleteGroup(1); err == nil || !strings.Contains(err.Error(), "cannot be deleted") {
+		t.Errorf("Expected a studied group to be kept; got %v", err)
+	}
+	if err := groups.DeleteGroup(2); err != nil {
+		t.Fatalf("Failed to delete group: %v", err)
+	}
+	if err := groups.DeleteGroup(2); err != sql.ErrNoRows {
+		t.Errorf("Expected deleting a group twice to fail; got %v", err)
+	}
+	if err := sessions.DeleteStudySession(1); err != nil {
+		t.Fatalf("Failed to delete study session: %v", err)
+	}
+
+	items, pagination, err := trash.GetTrash(1)
+	if err != nil {
+		t.Fatalf("Failed to list trash: %v", err)
+	}
+	if pagination.TotalItems != 3 {
+		t.Fatalf("Expected 3 items in the trash; got %+v", items)
+	}
+	types := make(map[string]int)
+	for _, item := range items {
+		types[item.Type] = item.ID
+	}
+	if types[TrashWord] != 2 || types[TrashGroup] != 2 || types[TrashStudySession] != 1 {
+		t.Errorf("Unexpected trash %+v", items)
+	}
+
+	// The review comes back once both its word and its session are restored
+	if err := trash.Restore(TrashWord, 2); err != nil {
+		t.Fatalf("Failed to restore word: %v", err)
+	}
+	if countReviews() != 0 {
+		t.Error("Expected the review to wait for its study session")
+	}
+	if err := trash.Restore(TrashStudySession, 1); err != nil {
+		t.Fatalf("Failed to restore study session: %v", err)
+	}
+	if countReviews() != 1 {
+		t.Error("Expected the review to be restored")
+	}
+	if err := trash.Restore(TrashWord, 2); err != sql.ErrNoRows {
+		t.Errorf("Expected restoring a live word to fail; got %v", err)
+	}
+	if err := trash.Restore("sentence", 1); err == nil || !strings.HasPrefix(err.Error(), "invalid") {
+		t.Errorf("Expected an unknown type to be rejected; got %v", err)
+	}
+
+	// Resetting the history archives it outside the trash
+	if err := sessions.ResetHistory(); err != nil {
+		t.Fatalf("Failed to reset history: %v", err)
+	}
+	if _, err := sessions.GetStudySessionByID(1); err != sql.ErrNoRows {
+		t.Errorf("Expected the session to be archived; got %v", err)
+	}
+	if _, pagination, err := trash.GetTrash(1); err != nil || pagination.TotalItems != 1 {
+		t.Errorf("Expected only the group in the trash; got %+v, %v", pagination, err)
+	}
+
+	// Purging keeps the archived history
+	purged, err := trash.Purge(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected the group to be purged; got %d items", purged)
+	}
+	var groupsLeft, archived int
+	if err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM groups WHERE id = 2),
+			(SELECT COUNT(*) FROM word_review_items WHERE archived_at IS NOT NULL)
+	`).Scan(&groupsLeft, &archived); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if groupsLeft != 0 || archived != 1 {
+		t.Errorf("Got %d purged groups left and %d archived reviews; want 0 and 1", groupsLeft, archived)
+	}
+}
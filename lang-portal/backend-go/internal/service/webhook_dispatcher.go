@@ -0,0 +1,192 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/logging"
+	"lang-portal/internal/models"
+)
+
+// Webhook request headers
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// SignWebhook returns the signature of a webhook body sent at timestamp: the
+// hex HMAC-SHA256, keyed with the secret of the webhook, of
+// "<timestamp>.<body>", prefixed with "sha256="
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher queues the events of the bus for the webhooks subscribed
+// to them and delivers them, retrying failed deliveries with exponential
+// backoff
+type WebhookDispatcher struct {
+	webhooks *WebhookService
+	client   *http.Client
+	// maxAttempts is the number of attempts after which a delivery fails
+	maxAttempts int
+	// backoff is the wait after the failed attempt number attempt
+	backoff      func(attempt int) time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+	wake         chan struct{}
+}
+
+func NewWebhookDispatcher(db *models.DB) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhooks:     NewWebhookService(db),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:  8,
+		backoff:      exponentialBackoff(30*time.Second, time.Hour),
+		pollInterval: time.Second,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// exponentialBackoff doubles the wait after every attempt, starting at base
+// and up to limit
+func exponentialBackoff(base, limit time.Duration) func(int) time.Duration {
+	return func(attempt int) time.Duration {
+		wait := base
+		for i := 1; i < attempt && wait < limit; i++ {
+			wait *= 2
+		}
+		return min(wait, limit)
+	}
+}
+
+// Run queues the events of bus and delivers due deliveries until ctx is done.
+// Deliveries are stored, so those pending when the server stops are sent
+// after it starts again.
+func (d *WebhookDispatcher) Run(ctx context.Context, bus *events.Bus) {
+	go d.queueEvents(ctx, bus)
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// queueEvents stores a delivery of every event on bus for each subscribed
+// webhook. When the dispatcher falls behind and the bus drops it, it resumes
+// from the history of the bus.
+func (d *WebhookDispatcher) queueEvents(ctx context.Context, bus *events.Bus) {
+	all := func(events.Event) bool { return true }
+	var lastID uint64
+	for {
+		subscription, missed, complete := bus.Subscribe(lastID, all)
+		if !complete {
+			logging.FromContext(ctx).Error("webhook events were lost", "after_event_id", lastID)
+		}
+		for _, e := range missed {
+			d.queue(ctx, e)
+			lastID = e.ID
+		}
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				subscription.Cancel()
+				return
+			case e, ok := <-subscription.C:
+				if open = ok; ok {
+					d.queue(ctx, e)
+					lastID = e.ID
+				}
+			}
+		}
+	}
+}
+
+func (d *WebhookDispatcher) queue(ctx context.Context, e events.Event) {
+	queued, err := d.webhooks.WithContext(ctx).queueEvent(e, d.now().UTC())
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to queue webhook deliveries", "event_id", e.ID, "error", err)
+	}
+	if queued > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliverDue attempts every delivery that is due
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) {
+	webhooks := d.webhooks.WithContext(ctx)
+	for ctx.Err() == nil {
+		due, err := webhooks.dueDeliveries(d.now().UTC(), 50)
+		if err != nil || len(due) == 0 {
+			return
+		}
+		for _, delivery := range due {
+			status, err := d.send(ctx, delivery)
+			now := d.now().UTC()
+			var retryAt *time.Time
+			if err != nil && delivery.Attempts+1 < d.maxAttempts {
+				next := now.Add(d.backoff(delivery.Attempts + 1))
+				retryAt = &next
+			}
+			if err != nil {
+				logging.FromContext(ctx).Warn("webhook delivery failed",
+					"delivery_id", delivery.ID, "webhook_id", delivery.WebhookID,
+					"attempt", delivery.Attempts+1, "error", err)
+			}
+			if err := webhooks.recordAttempt(delivery.ID, status, err, now, retryAt); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send posts a delivery to its webhook. Responses other than 2xx fail.
+func (d *WebhookDispatcher) send(ctx context.Context, delivery dueDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lang-portal-webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/models"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookService struct {
+	db *models.DB
+	// deliveries writes the delivery log, which does not change the data
+	// version
+	deliveries *models.DB
+}
+
+func NewWebhookService(db *models.DB) *WebhookService {
+	return &WebhookService{db: db, deliveries: db.Untracked()}
+}
+
+// WithContext returns a copy of s that runs its queries in ctx
+func (s *WebhookService) WithContext(ctx context.Context) *WebhookService {
+	return &WebhookService{db: s.db.WithContext(ctx), deliveries: s.deliveries.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *WebhookService) labeled(method string) *WebhookService {
+	c := *s
+	c.db = s.db.Labeled("WebhookService." + method)
+	c.deliveries = s.deliveries.Labeled("WebhookService." + method)
+	return &c
+}
+
+const webhookColumns = `id, url, event_types, active, created_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var eventTypes string
+	if err := row.Scan(&webhook.ID, &webhook.URL, &eventTypes, &webhook.Active, &webhook.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(eventTypes), &webhook.EventTypes); err != nil {
+		return nil, fmt.Errorf("webhook %d has invalid event types: %w", webhook.ID, err)
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookService) ListWebhooks() ([]models.Webhook, error) {
+	s = s.labeled("ListWebhooks")
+	rows, err := s.db.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *WebhookService) GetWebhook(id int) (*models.Webhook, error) {
+	s = s.labeled("GetWebhook")
+	return scanWebhook(s.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+}
+
+// validateWebhook checks the URL and event types of a webhook
+func validateWebhook(rawURL string, eventTypes []string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid url: must be an absolute http or https URL")
+	}
+	if len(eventTypes) == 0 {
+		return "", fmt.Errorf("invalid event_types: at least one event type is required")
+	}
+	for _, eventType := range eventTypes {
+		known := false
+		for _, t := range events.Types {
+			known = known || t == eventType
+		}
+		if !known {
+			return "", fmt.Errorf("invalid event_types: unknown event type %q", eventType)
+		}
+	}
+	encoded, err := json.Marshal(eventTypes)
+	return string(encoded), err
+}
+
+// CreateWebhook subscribes url to eventTypes. Without a secret one is
+// generated. The secret is only returned here.
+func (s *WebhookService) CreateWebhook(rawURL, secret string, eventTypes []string) (*models.Webhook, error) {
+	s = s.labeled("CreateWebhook")
+	encoded, err := validateWebhook(rawURL, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	var id int
+	err = s.db.QueryRow(
+		"INSERT INTO webhooks (url, secret, event_types) VALUES (?, ?, ?) RETURNING id",
+		rawURL, secret, encoded,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	webhook, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// UpdateWebhook replaces the URL, event types and state of a webhook. An
+// empty secret keeps the current one.
+func (s *WebhookService) UpdateWebhook(id int, rawURL, secret string, eventTypes []string, active bool) (*models.Webhook, error) {
+	s = s.labeled("UpdateWebhook")
+	encoded, err := validateWebhook(rawURL, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.db.Exec(
+		"UPDATE webhooks SET url = ?, secret = COALESCE(NULLIF(?, ''), secret), event_types = ?, active = ? WHERE id = ?",
+		rawURL, secret, encoded, active, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.GetWebhook(id)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (s *WebhookService) DeleteWebhook(id int) error {
+	s = s.labeled("DeleteWebhook")
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+const deliveryColumns = `
+	id, webhook_id, event_id, event_type, payload, status, attempts, response_status,
+	last_error, next_attempt_at, replay_of, created_at, delivered_at
+`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var responseStatus, replayOf sql.NullInt64
+	var lastError sql.NullString
+	var nextAttemptAt, deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&responseStatus, &lastError, &nextAttemptAt, &replayOf, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	if replayOf.Valid {
+		id := int(replayOf.Int64)
+		d.ReplayOf = &id
+	}
+	if lastError.Valid {
+		d.LastError = &lastError.String
+	}
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+// ListDeliveries lists the deliveries of a webhook, newest first
+func (s *WebhookService) ListDeliveries(webhookID, page int) ([]models.WebhookDelivery, *models.Pagination, error) {
+	s = s.labeled("ListDeliveries")
+	const itemsPerPage = 100
+	if _, err := s.GetWebhook(webhookID); err != nil {
+		return nil, nil, err
+	}
+
+	var totalItems int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?", webhookID).Scan(&totalItems); err != nil {
+		return nil, nil, err
+	}
+	rows, err := s.db.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, webhookID, itemsPerPage, (page-1)*itemsPerPage)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return deliveries, &models.Pagination{
+		CurrentPage:  page,
+		TotalPages:   (totalItems + itemsPerPage - 1) / itemsPerPage,
+		TotalItems:   totalItems,
+		ItemsPerPage: itemsPerPage,
+	}, nil
+}
+
+func (s *WebhookService) GetDelivery(id int) (*models.WebhookDelivery, error) {
+	s = s.labeled("GetDelivery")
+	return scanDelivery(s.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id))
+}
+
+// ReplayDelivery sends the payload of a delivery of webhookID again, as a
+// new delivery that is due right away
+func (s *WebhookService) ReplayDelivery(webhookID, deliveryID int) (*models.WebhookDelivery, error) {
+	s = s.labeled("ReplayDelivery")
+	var id int
+	err := s.deliveries.QueryRow(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, next_attempt_at, replay_of)
+		SELECT webhook_id, event_id, event_type, payload, ?, id
+		FROM webhook_deliveries
+		WHERE id = ? AND webhook_id = ?
+		RETURNING id
+	`, time.Now().UTC(), deliveryID, webhookID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDelivery(id)
+}
+
+// queueEvent adds a delivery of e for every active webhook subscribed to its
+// type. It returns the number of deliveries.
+func (s *WebhookService) queueEvent(e events.Event, now time.Time) (int, error) {
+	s = s.labeled("queueEvent")
+	webhooks, err := s.ListWebhooks()
+	if err != nil {
+		return 0, err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, webhook := range webhooks {
+		if !webhook.Active || !subscribes(webhook, e.Type) {
+			continue
+		}
+		_, err := s.deliveries.Exec(
+			"INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, next_attempt_at) VALUES (?, ?, ?, ?, ?)",
+			webhook.ID, e.ID, e.Type, string(payload), now,
+		)
+		if err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+func subscribes(webhook models.Webhook, eventType string) bool {
+	for _, t := range webhook.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// dueDelivery is a pending delivery with what is needed to send it
+type dueDelivery struct {
+	models.WebhookDelivery
+	url    string
+	secret string
+}
+
+// dueDeliveries returns pending deliveries of active webhooks whose next
+// attempt is due, oldest first
+func (s *WebhookService) dueDeliveries(now time.Time, limit int) ([]dueDelivery, error) {
+	s = s.labeled("dueDeliveries")
+	rows, err := s.db.Query(`
+		SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND w.active AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?
+	`, DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Attempts, &d.url, &d.secret); err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// recordAttempt stores the outcome of an attempt. A failed attempt is retried
+// at retryAt, or the delivery fails when retryAt is nil.
+func (s *WebhookService) recordAttempt(id, responseStatus int, attemptErr error, now time.Time, retryAt *time.Time) error {
+	s = s.labeled("recordAttempt")
+	var status sql.NullInt64
+	if responseStatus != 0 {
+		status = sql.NullInt64{Int64: int64(responseStatus), Valid: true}
+	}
+	if attemptErr == nil {
+		_, err := s.deliveries.Exec(`
+			UPDATE webhook_deliveries
+			SET status = ?, attempts = attempts + 1, response_status = ?, last_error = NULL,
+				next_attempt_at = NULL, delivered_at = ?
+			WHERE id = ?
+		`, DeliverySucceeded, status, now, id)
+		return err
+	}
+
+	next := DeliveryPending
+	if retryAt == nil {
+		next = DeliveryFailed
+	}
+	_, err := s.deliveries.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, response_status = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?
+	`, next, status, strings.TrimSpace(attemptErr.Error()), retryAt, id)
+	return err
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"lang-portal/internal/events"
+	"lang-portal/internal/testdb"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	db := testdb.New(t)
+
+	// The receiver fails the first attempt and checks the signature of all
+	var mu sync.Mutex
+	var received [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhook("s3cret", timestamp, body) {
+			t.Errorf("Invalid signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		if r.Header.Get(WebhookEventHeader) != events.ReviewRecorded {
+			t.Errorf("Event header = %q", r.Header.Get(WebhookEventHeader))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, body)
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	webhooks := NewWebhookService(db)
+	webhook, err := webhooks.CreateWebhook(receiver.URL, "s3cret", []string{events.ReviewRecorded})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	if _, err := webhooks.CreateWebhook(receiver.URL, "", []string{events.SessionCompleted}); err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher := NewWebhookDispatcher(db)
+	dispatcher.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	bus := events.NewBus(10)
+	e := bus.Publish(events.ReviewRecorded, "alice", map[string]interface{}{"word_id": 1, "correct": true})
+	version, _ := db.DataVersion()
+	dispatcher.queue(ctx, e)
+	dispatcher.deliverDue(ctx)
+	if after, _ := db.DataVersion(); after != version {
+		t.Errorf("Expected the delivery log to leave the data version at %d; got %d", version, after)
+	}
+
+	deliveries, _, err := webhooks.ListDeliveries(webhook.ID, 1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery; got %v, %v", deliveries, err)
+	}
+	first := deliveries[0]
+	if first.Status != DeliveryPending || first.Attempts != 1 || *first.ResponseStatus != http.StatusServiceUnavailable {
+		t.Errorf("Expected a failed attempt to be retried; got %+v", first)
+	}
+	if want := now.Add(30 * time.Second); first.NextAttemptAt == nil || !first.NextAttemptAt.Equal(want) {
+		t.Errorf("Next attempt at %v; want %v", first.NextAttemptAt, want)
+	}
+
+	// Nothing is sent before the backoff has passed
+	dispatcher.deliverDue(ctx)
+	if len(received) != 1 {
+		t.Fatalf("Expected no retry before the backoff; got %d requests", len(received))
+	}
+	now = now.Add(30 * time.Second)
+	dispatcher.deliverDue(ctx)
+
+	delivery, err := webhooks.GetDelivery(first.ID)
+	if err != nil {
+		t.Fatalf("Failed to get delivery: %v", err)
+	}
+	if delivery.Status != DeliverySucceeded || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Errorf("Expected the retry to succeed; got %+v", delivery)
+	}
+	if string(received[1]) != delivery.Payload {
+		t.Errorf("Received %s; want the stored payload %s", received[1], delivery.Payload)
+	}
+
+	// Replays send the same payload as a new delivery
+	replay, err := webhooks.ReplayDelivery(webhook.ID, first.ID)
+	if err != nil {
+		t.Fatalf("Failed to replay delivery: %v", err)
+	}
+	now = time.Now().UTC()
+	dispatcher.deliverDue(ctx)
+	if replay, err = webhooks.GetDelivery(replay.ID); err != nil || replay.Status != DeliverySucceeded || *replay.ReplayOf != first.ID {
+		t.Errorf("Expected the replay to be delivered; got %+v, %v", replay, err)
+	}
+	if len(received) != 3 || string(received[2]) != string(received[1]) {
+		t.Errorf("Expected the replay to resend the payload; got %d requests", len(received))
+	}
+}
+
+func TestWebhookDeliveryFails(t *testing.T) {
+	db := testdb.New(t)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	webhooks := NewWebhookService(db)
+	webhook, err := webhooks.CreateWebhook(receiver.URL, "", []string{events.SessionCompleted})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	if len(webhook.Secret) != 64 {
+		t.Errorf("Expected a generated secret; got %q", webhook.Secret)
+	}
+
+	dispatcher := NewWebhookDispatcher(db)
+	dispatcher.maxAttempts = 3
+	dispatcher.backoff = func(int) time.Duration { return 0 }
+	ctx := context.Background()
+	dispatcher.queue(ctx, events.NewBus(10).Publish(events.SessionCompleted, "", nil))
+	dispatcher.deliverDue(ctx)
+
+	deliveries, _, err := webhooks.ListDeliveries(webhook.ID, 1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery; got %v, %v", deliveries, err)
+	}
+	if d := deliveries[0]; d.Status != DeliveryFailed || d.Attempts != 3 || d.NextAttemptAt != nil || *d.LastError != "unexpected status 500" {
+		t.Errorf("Expected the delivery to fail after 3 attempts; got %+v", d)
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	db := testdb.New(t)
+	webhooks := NewWebhookService(db)
+	tests := []struct {
+		url        string
+		eventTypes []string
+	}{
+		{"ftp://example.com/hook", []string{events.ReviewRecorded}},
+		{"/hook", []string{events.ReviewRecorded}},
+		{"https://example.com/hook", nil},
+		{"https://example.com/hook", []string{"review.deleted"}},
+	}
+	for _, tt := range tests {
+		if _, err := webhooks.CreateWebhook(tt.url, "", tt.eventTypes); err == nil {
+			t.Errorf("Expected %q with %v to be rejected", tt.url, tt.eventTypes)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := exponentialBackoff(30*time.Second, time.Hour)
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 10: time.Hour} {
+		if got := backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v; want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestStreakExtendedEvent(t *testing.T) {
+	// The fixtures have a session yesterday, so today's first session extends
+	// the streak to 2 days
+	db := testdb.New(t)
+	subscription, _, _ := events.Default.Subscribe(0, func(e events.Event) bool { return e.Type == events.StreakExtended })
+	defer subscription.Cancel()
+
+	signer, err := NewSessionTokenSigner([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	activities := NewStudyActivitiesService(db, signer)
+	for i := 0; i < 2; i++ {
+		if _, err := activities.CreateStudySession(1, 1); err != nil {
+			t.Fatalf("Failed to create study session: %v", err)
+		}
+	}
+
+	e := <-subscription.C
+	if data := e.Data.(map[string]interface{}); data["streak_days"] != 2 {
+		t.Errorf("Expected a 2 day streak; got %+v", e)
+	}
+	select {
+	case e := <-subscription.C:
+		t.Errorf("Expected only the first session of the day to extend the streak; got %+v", e)
+	default:
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"lang-portal/internal/models"
+)
+
+// DefaultRecentReviews is how many of the latest reviews the recent accuracy
+// of a word covers by default
+const DefaultRecentReviews = 10
+
+// GetWordReviews returns the reviews of a word, oldest first, with stats over
+// all of them. The recent accuracy covers the last recent reviews.
+func (s *WordService) GetWordReviews(wordID, page, recent int) (*models.WordReviewHistory, error) {
+	s = s.labeled("GetWordReviews")
+	if recent < 1 {
+		return nil, fmt.Errorf("invalid number of recent reviews %d", recent)
+	}
+
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM words WHERE id = ? AND deleted_at IS NULL)", wordID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	itemsPerPage := 100
+	offset := (page - 1) * itemsPerPage
+
+	query := `
+		SELECT
+			wri.study_session_id,
+			ss.group_id,
+			COALESCE(g.name, ''),
+			ss.study_activity_id,
+			COALESCE(sa.name, ''),
+			wri.correct,
+			wri.response_time_ms,
+			wri.created_at
+		FROM word_review_items wri
+		JOIN study_sessions ss ON ss.id = wri.study_session_id
+		LEFT JOIN groups g ON g.id = ss.group_id
+		LEFT JOIN study_activities sa ON sa.id = ss.study_activity_id
+		WHERE wri.word_id = ? AND wri.deleted_at IS NULL
+		ORDER BY wri.created_at, wri.rowid
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.db.Query(query, wordID, itemsPerPage, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]models.WordReview, 0)
+	for rows.Next() {
+		var review models.WordReview
+		var responseTime sql.NullInt64
+		if err := rows.Scan(
+			&review.StudySessionID,
+			&review.GroupID,
+			&review.GroupName,
+			&review.StudyActivityID,
+			&review.StudyActivityName,
+			&review.Correct,
+			&responseTime,
+			&review.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if responseTime.Valid {
+			ms := int(responseTime.Int64)
+			review.ResponseTimeMs = &ms
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.wordReviewStats(wordID, recent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WordReviewHistory{
+		WordID: wordID,
+		Items:  reviews,
+		Pagination: &models.Pagination{
+			CurrentPage:  page,
+			TotalPages:   (stats.TotalReviews + itemsPerPage - 1) / itemsPerPage,
+			TotalItems:   stats.TotalReviews,
+			ItemsPerPage: itemsPerPage,
+		},
+		Stats: *stats,
+	}, nil
+}
+
+func (s *WordService) wordReviewStats(wordID, recent int) (*models.WordReviewStats, error) {
+	stats := models.WordReviewStats{RecentReviews: recent}
+
+	// The streak counts the correct reviews after the latest wrong one, in the
+	// order of the history. Imported and restored reviews have new rowids but
+	// old times, so the rowid only breaks ties.
+	query := `
+		SELECT
+			COUNT(*),
+			COUNT(CASE WHEN r.correct THEN 1 END),
+			COUNT(CASE WHEN r.correct AND NOT EXISTS (
+				SELECT 1 FROM word_review_items wrong
+				WHERE wrong.word_id = r.word_id AND NOT wrong.correct AND wrong.deleted_at IS NULL
+				AND (wrong.created_at > r.created_at OR (wrong.created_at = r.created_at AND wrong.rowid > r.rowid))
+			) THEN 1 END),
+			AVG(r.response_time_ms)
+		FROM word_review_items r
+		WHERE r.word_id = ? AND r.deleted_at IS NULL
+	`
+	var averageResponseTime sql.NullFloat64
+	if err := s.db.QueryRow(query, wordID).Scan(
+		&stats.TotalReviews,
+		&stats.CorrectCount,
+		&stats.CurrentCorrectStreak,
+		&averageResponseTime,
+	); err != nil {
+		return nil, err
+	}
+	stats.WrongCount = stats.TotalReviews - stats.CorrectCount
+	if averageResponseTime.Valid {
+		average := math.Round(averageResponseTime.Float64*10) / 10
+		stats.AverageResponseTimeMs = &average
+	}
+	if stats.TotalReviews == 0 {
+		return &stats, nil
+	}
+
+	var lastReviewedAt time.Time
+	lastQuery := `
+		SELECT created_at FROM word_review_items
+		WHERE word_id = ? AND deleted_at IS NULL
+		ORDER BY created_at DESC, rowid DESC
+		LIMIT 1
+	`
+	if err := s.db.QueryRow(lastQuery, wordID).Scan(&lastReviewedAt); err != nil {
+		return nil, err
+	}
+	stats.LastReviewedAt = &lastReviewedAt
+
+	recentQuery := `
+		SELECT AVG(correct) FROM (
+			SELECT correct FROM word_review_items
+			WHERE word_id = ? AND deleted_at IS NULL
+			ORDER BY created_at DESC, rowid DESC
+			LIMIT ?
+		)
+	`
+	var recentAccuracy float64
+	if err := s.db.QueryRow(recentQuery, wordID, recent).Scan(&recentAccuracy); err != nil {
+		return nil, err
+	}
+	recentAccuracy = math.Round(recentAccuracy*1000) / 10
+	stats.RecentAccuracy = &recentAccuracy
+
+	return &stats, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"lang-portal/internal/testdb"
+)
+
+func TestGetWordReviews(t *testing.T) {
+	db := testdb.New(t)
+	sessions := NewStudySessionsService(db, nil)
+	words := NewWordService(db)
+
+	if _, err := db.Exec(`INSERT INTO study_sessions (id, group_id, study_activity_id) VALUES (2, 1, 1), (3, 2, 1), (4, 1, 1)`); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	reviews := []struct {
+		sessionID      int
+		correct        bool
+		responseTimeMs int
+	}{
+		{1, true, 0}, {2, false, 3000}, {3, true, 1000}, {4, true, 2000},
+	}
+	for _, r := range reviews {
+		if err := sessions.ReviewWordTimed(r.sessionID, 1, r.correct, r.responseTimeMs); err != nil {
+			t.Fatalf("Failed to review word: %v", err)
+		}
+	}
+
+	history, err := words.GetWordReviews(1, 1, 3)
+	if err != nil {
+		t.Fatalf("Failed to get word reviews: %v", err)
+	}
+	if len(history.Items) != 4 || history.Pagination.TotalItems != 4 {
+		t.Fatalf("Expected 4 reviews; got %d of %d", len(history.Items), history.Pagination.TotalItems)
+	}
+	first, last := history.Items[0], history.Items[3]
+	if first.StudySessionID != 1 || !first.Correct || first.ResponseTimeMs != nil {
+		t.Errorf("Expected the oldest review first; got %+v", first)
+	}
+	if last.StudySessionID != 4 || last.GroupName != "Animals" || last.StudyActivityName != "Flashcards" || *last.ResponseTimeMs != 2000 {
+		t.Errorf("Expected the review to carry its session; got %+v", last)
+	}
+
+	stats := history.Stats
+	if stats.TotalReviews != 4 || stats.CorrectCount != 3 || stats.WrongCount != 1 {
+		t.Errorf("Expected 3 of 4 correct; got %+v", stats)
+	}
+	if stats.CurrentCorrectStreak != 2 {
+		t.Errorf("Current streak = %d; want 2", stats.CurrentCorrectStreak)
+	}
+	if stats.RecentReviews != 3 || *stats.RecentAccuracy != 66.7 {
+		t.Errorf("Recent accuracy = %v over %d; want 66.7 over 3", *stats.RecentAccuracy, stats.RecentReviews)
+	}
+	if *stats.AverageResponseTimeMs != 2000 {
+		t.Errorf("Average response time = %v; want 2000", *stats.AverageResponseTimeMs)
+	}
+	if stats.LastReviewedAt == nil || !stats.LastReviewedAt.Equal(last.CreatedAt) {
+		t.Errorf("Last reviewed at %v; want %v", stats.LastReviewedAt, last.CreatedAt)
+	}
+
+	// Words without reviews have no accuracy or last review
+	history, err = words.GetWordReviews(2, 1, DefaultRecentReviews)
+	if err != nil {
+		t.Fatalf("Failed to get word reviews: %v", err)
+	}
+	if len(history.Items) != 0 || history.Stats.RecentAccuracy != nil || history.Stats.LastReviewedAt != nil || history.Stats.AverageResponseTimeMs != nil {
+		t.Errorf("Expected empty stats; got %+v", history.Stats)
+	}
+
+	if _, err := words.GetWordReviews(99, 1, DefaultRecentReviews); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing word; got %v", err)
+	}
+	if _, err := words.GetWordReviews(1, 1, 0); err == nil {
+		t.Error("Expected an error for 0 recent reviews")
+	}
+}
+
+func TestWordReviewStreakFollowsHistory(t *testing.T) {
+	db := testdb.New(t)
+	words := NewWordService(db)
+
+	if _, err := db.Exec(`INSERT INTO study_sessions (id, group_id, study_activity_id) VALUES (2, 1, 1), (3, 1, 1)`); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	// The wrong review was imported after the correct ones but happened first
+	if _, err := db.Exec(`
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+			(1, 1, 1, datetime('now', '-2 hours')),
+			(1, 2, 1, datetime('now', '-1 hours')),
+			(1, 3, 0, datetime('now', '-3 hours'))
+	`); err != nil {
+		t.Fatalf("Failed to insert reviews: %v", err)
+	}
+
+	history, err := words.GetWordReviews(1, 1, DefaultRecentReviews)
+	if err != nil {
+		t.Fatalf("Failed to get word reviews: %v", err)
+	}
+	if history.Stats.CurrentCorrectStreak != 2 {
+		t.Errorf("Current streak = %d; want 2", history.Stats.CurrentCorrectStreak)
+	}
+}
+
+func TestReviewWordRejectsNegativeResponseTime(t *testing.T) {
+	db := testdb.New(t)
+	sessions := NewStudySessionsService(db, nil)
+
+	err := sessions.ReviewWordTimed(1, 1, true, -5)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid") {
+		t.Errorf("Expected a negative response time to be rejected; got %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM word_review_items").Scan(&count); err != nil {
+		t.Fatalf("Failed to count reviews: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no review to be recorded; got %d", count)
+	}
+}
+
+func TestReviewWordTwiceInSession(t *testing.T) {
+	db := testdb.New(t)
+	sessions := NewStudySessionsService(db, nil)
+	words := NewWordService(db)
+
+	for _, correct := range []bool{false, true} {
+		if err := sessions.ReviewWord(1, 1, correct); err != nil {
+			t.Fatalf("Failed to review word: %v", err)
+		}
+	}
+
+	history, err := words.GetWordReviews(1, 1, DefaultRecentReviews)
+	if err != nil {
+		t.Fatalf("Failed to get word reviews: %v", err)
+	}
+	if history.Stats.TotalReviews != 2 || history.Stats.CurrentCorrectStreak != 1 {
+		t.Errorf("Expected both reviews to be kept; got %+v", history.Stats)
+	}
+}
@@ -1,7 +1,10 @@
 package service
 
 import (
+	"context"
 	"database/sql"
+
+	"lang-portal/internal/events"
 	"lang-portal/internal/models"
 )
 
@@ -13,6 +16,19 @@ func NewWordService(db *models.DB) *WordService {
 	return &WordService{db: db}
 }
 
+// WithContext returns a copy of the service that runs its queries in ctx
+func (s *WordService) WithContext(ctx context.Context) *WordService {
+	return &WordService{db: s.db.WithContext(ctx)}
+}
+
+// labeled returns a copy of s whose queries are observed under method in
+// metrics, unless they already are under the method that called it
+func (s *WordService) labeled(method string) *WordService {
+	c := *s
+	c.db = s.db.Labeled("WordService." + method)
+	return &c
+}
+
 type WordWithStats struct {
 	Japanese     string `json:"japanese"`
 	Romaji       string `json:"romaji"`
@@ -40,27 +56,32 @@ type GroupInfo struct {
 	TotalWordCount int    `json:"total_word_count"`
 }
 
-func (s *WordService) GetWords(page int) (*models.WordsResponse, error) {
+// GetWords lists words with their review stats. An empty language lists words of every language.
+func (s *WordService) GetWords(page int, language string) (*models.WordsResponse, error) {
+	s = s.labeled("GetWords")
 	const itemsPerPage = 100
 	offset := (page - 1) * itemsPerPage
 
 	query := `
 		SELECT 
-			w.japanese,
-			w.romaji,
-			w.english,
+			w.id,
+			w.language,
+			w.term,
+			w.transliteration,
+			w.meaning,
 			COUNT(CASE WHEN wri.correct THEN 1 END) as correct_count,
 			COUNT(CASE WHEN NOT wri.correct THEN 1 END) as wrong_count
 		FROM words w
-		LEFT JOIN word_review_items wri ON w.id = wri.word_id
-		GROUP BY w.id, w.japanese, w.romaji, w.english
+		LEFT JOIN word_review_items wri ON w.id = wri.word_id AND wri.deleted_at IS NULL
+		WHERE (? = '' OR w.language = ?) AND w.deleted_at IS NULL
+		GROUP BY w.id, w.language, w.term, w.transliteration, w.meaning
 		ORDER BY w.id
 		LIMIT ? OFFSET ?
 	`
 
-	countQuery := `SELECT COUNT(*) FROM words`
+	countQuery := `SELECT COUNT(*) FROM words WHERE (? = '' OR language = ?) AND deleted_at IS NULL`
 
-	rows, err := s.db.Query(query, itemsPerPage, offset)
+	rows, err := s.db.Query(query, language, language, itemsPerPage, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -70,19 +91,26 @@ func (s *WordService) GetWords(page int) (*models.WordsResponse, error) {
 	for rows.Next() {
 		var word models.WordWithStats
 		if err := rows.Scan(
-			&word.Japanese,
-			&word.Romaji,
-			&word.English,
+			&word.ID,
+			&word.Language,
+			&word.Term,
+			&word.Transliteration,
+			&word.Meaning,
 			&word.CorrectCount,
 			&word.WrongCount,
 		); err != nil {
 			return nil, err
 		}
+		word.LegacyWordFields = models.NewLegacyWordFields(word.Language, word.Term, word.Transliteration, word.Meaning)
 		words = append(words, word)
 	}
 
+	if err := fillWordDetails(s.db, words); err != nil {
+		return nil, err
+	}
+
 	var totalItems int
-	if err := s.db.QueryRow(countQuery).Scan(&totalItems); err != nil {
+	if err := s.db.QueryRow(countQuery, language, language).Scan(&totalItems); err != nil {
 		return nil, err
 	}
 
@@ -107,11 +135,13 @@ func (s *WordService) GetWords(page int) (*models.WordsResponse, error) {
 }
 
 func (s *WordService) GetWordByID(id int) (*models.WordDetailResponse, error) {
+	s = s.labeled("GetWordByID")
 	wordQuery := `
 		SELECT 
-			w.japanese,
-			w.romaji,
-			w.english
+			w.language,
+			w.term,
+			w.transliteration,
+			w.meaning
 		FROM words w
 		WHERE w.id = ?
 	`
@@ -121,22 +151,24 @@ func (s *WordService) GetWordByID(id int) (*models.WordDetailResponse, error) {
 			COUNT(CASE WHEN correct THEN 1 END) as correct_count,
 			COUNT(CASE WHEN NOT correct THEN 1 END) as wrong_count
 		FROM word_review_items
-		WHERE word_id = ?
+		WHERE word_id = ? AND deleted_at IS NULL
 	`
 
 	groupsQuery := `
 		SELECT 
 			g.id,
 			g.name,
-			(SELECT COUNT(*) FROM words_groups WHERE group_id = g.id) as total_word_count
+			g.language,
+			(SELECT COUNT(*) FROM words_groups wg2 JOIN words w2 ON w2.id = wg2.word_id
+				WHERE wg2.group_id = g.id AND w2.deleted_at IS NULL) as total_word_count
 		FROM groups g
 		JOIN words_groups wg ON g.id = wg.group_id
-		WHERE wg.word_id = ?
+		WHERE wg.word_id = ? AND g.deleted_at IS NULL
 	`
 
 	// First check if word exists
 	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM words WHERE id = ?)`
+	checkQuery := `SELECT EXISTS(SELECT 1 FROM words WHERE id = ? AND deleted_at IS NULL)`
 	if err := s.db.QueryRow(checkQuery, id).Scan(&exists); err != nil {
 		return nil, err
 	}
@@ -148,12 +180,14 @@ func (s *WordService) GetWordByID(id int) (*models.WordDetailResponse, error) {
 	word.Groups = make([]models.GroupWithStats, 0)
 
 	if err := s.db.QueryRow(wordQuery, id).Scan(
-		&word.Japanese,
-		&word.Romaji,
-		&word.English,
+		&word.Language,
+		&word.Term,
+		&word.Transliteration,
+		&word.Meaning,
 	); err != nil {
 		return nil, err
 	}
+	word.LegacyWordFields = models.NewLegacyWordFields(word.Language, word.Term, word.Transliteration, word.Meaning)
 
 	if err := s.db.QueryRow(statsQuery, id).Scan(
 		&word.Stats.CorrectCount,
@@ -162,6 +196,16 @@ func (s *WordService) GetWordByID(id int) (*models.WordDetailResponse, error) {
 		return nil, err
 	}
 
+	word.ID = id
+	history, err := reviewHistory(s.db, "wri.word_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	word.Stats.Mastery = masteryLevel(history[id])
+	if reviews := history[id]; len(reviews) > 0 {
+		word.LastReviewedAt = &reviews[len(reviews)-1].at
+	}
+
 	rows, err := s.db.Query(groupsQuery, id)
 	if err != nil {
 		return nil, err
@@ -173,6 +217,7 @@ func (s *WordService) GetWordByID(id int) (*models.WordDetailResponse, error) {
 		if err := rows.Scan(
 			&group.ID,
 			&group.Name,
+			&group.Language,
 			&group.Stats.TotalWordCount,
 		); err != nil {
 			return nil, err
@@ -180,5 +225,120 @@ func (s *WordService) GetWordByID(id int) (*models.WordDetailResponse, error) {
 		word.Groups = append(word.Groups, group)
 	}
 
+	sentencesQuery := `
+		SELECT id, word_id, sentence, reading, translation, source, created_at
+		FROM example_sentences
+		WHERE word_id = ?
+		ORDER BY id
+	`
+
+	sentenceRows, err := s.db.Query(sentencesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer sentenceRows.Close()
+
+	word.ExampleSentences = make([]models.ExampleSentence, 0)
+	for sentenceRows.Next() {
+		var sentence models.ExampleSentence
+		if err := sentenceRows.Scan(
+			&sentence.ID,
+			&sentence.WordID,
+			&sentence.Sentence,
+			&sentence.Reading,
+			&sentence.Translation,
+			&sentence.Source,
+			&sentence.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		word.ExampleSentences = append(word.ExampleSentences, sentence)
+	}
+
 	return &word, nil
-}
\ No newline at end of file
+}
+
+// fillWordDetails fills in the mastery level, the last review time and the
+// groups of listed words. Smart groups are not listed as they are evaluated
+// when read.
+func fillWordDetails(db *models.DB, words []models.WordWithStats) error {
+	ids := make([]int, len(words))
+	for i := range words {
+		ids[i] = words[i].ID
+		words[i].Mastery = MasteryNew
+		words[i].Groups = make([]models.GroupRef, 0)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders, args := idPlaceholders(ids)
+
+	history, err := reviewHistory(db, "wri.word_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[int][]models.GroupRef)
+	rows, err := db.Query(`
+		SELECT wg.word_id, g.id, g.name
+		FROM words_groups wg
+		JOIN groups g ON wg.group_id = g.id
+		WHERE wg.word_id IN (`+placeholders+`) AND g.deleted_at IS NULL
+		ORDER BY g.name
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wordID int
+		var group models.GroupRef
+		if err := rows.Scan(&wordID, &group.ID, &group.Name); err != nil {
+			return err
+		}
+		groups[wordID] = append(groups[wordID], group)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range words {
+		if reviews := history[words[i].ID]; len(reviews) > 0 {
+			words[i].Mastery = masteryLevel(reviews)
+			words[i].LastReviewedAt = &reviews[len(reviews)-1].at
+		}
+		if memberships, ok := groups[words[i].ID]; ok {
+			words[i].Groups = memberships
+		}
+	}
+	return nil
+}
+
+// DeleteWord moves a word and its reviews to the trash
+func (s *WordService) DeleteWord(id int) error {
+	s = s.labeled("DeleteWord")
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE words SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("UPDATE word_review_items SET deleted_at = CURRENT_TIMESTAMP WHERE word_id = ?", id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	events.PublishShared(events.WordUpdated, map[string]interface{}{"id": id})
+	return nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+
+	"lang-portal/internal/testdb"
+)
+
+func TestWordListDetails(t *testing.T) {
+	db := testdb.New(t)
+	if _, err := db.Exec(`
+		INSERT INTO word_review_items (word_id, study_session_id, correct, created_at) VALUES
+		(2, 1, 1, '2025-02-08 10:00:00');
+	`); err != nil {
+		t.Fatalf("Failed to insert review: %v", err)
+	}
+
+	response, err := NewWordService(db).GetWords(1, "")
+	if err != nil {
+		t.Fatalf("Failed to get words: %v", err)
+	}
+	if len(response.Items) != 5 {
+		t.Fatalf("Expected 5 words; got %d", len(response.Items))
+	}
+
+	cat := response.Items[1]
+	if cat.ID != 2 || cat.Term != "猫" {
+		t.Fatalf("Expected word 2 to be 猫; got %+v", cat)
+	}
+	if cat.LastReviewedAt == nil || cat.LastReviewedAt.Format("2006-01-02 15:04:05") != "2025-02-08 10:00:00" {
+		t.Errorf("Unexpected last review time: %v", cat.LastReviewedAt)
+	}
+	if len(cat.Groups) != 1 || cat.Groups[0].ID != 1 || cat.Groups[0].Name != "Animals" {
+		t.Errorf("Expected 猫 to be in Animals; got %+v", cat.Groups)
+	}
+	if horse := response.Items[4]; horse.LastReviewedAt != nil || horse.Mastery != MasteryNew {
+		t.Errorf("Expected 馬 to be unreviewed; got %+v", horse)
+	}
+
+	detail, err := NewWordService(db).GetWordByID(2)
+	if err != nil {
+		t.Fatalf("Failed to get word: %v", err)
+	}
+	if detail.ID != 2 || detail.LastReviewedAt == nil {
+		t.Errorf("Expected the word detail to carry its ID and last review; got %+v", detail)
+	}
+}
@@ -0,0 +1,67 @@
+// Package testdb provides the database the tests of other packages run
+// against: a temporary database with the real migrations applied and the
+// same fixture data as the rspec suite.
+package testdb
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	dbmigrate "lang-portal/internal/db"
+	"lang-portal/internal/models"
+)
+
+// Fixtures are the words, groups, study activity and study session every
+// test database starts with. Session 1 studies the Animals, words 1 to 4,
+// and started a day ago.
+const Fixtures = `
+	INSERT INTO words (id, term, transliteration, meaning) VALUES
+	(1, '犬', 'inu', 'dog'),
+	(2, '猫', 'neko', 'cat'),
+	(3, '鳥', 'tori', 'bird'),
+	(4, '魚', 'sakana', 'fish'),
+	(5, '馬', 'uma', 'horse');
+	INSERT INTO groups (id, name) VALUES (1, 'Animals'), (2, 'Basic Words');
+	INSERT INTO words_groups (word_id, group_id) VALUES (1, 1), (2, 1), (3, 1), (4, 1), (5, 2);
+	INSERT INTO study_activities (id, name, thumbnail_url, description) VALUES
+	(1, 'Flashcards', 'https://example.com/flashcards.png', 'Practice with flashcards');
+	INSERT INTO study_sessions (id, group_id, created_at, study_activity_id) VALUES
+	(1, 1, datetime('now', '-1 day'), 1);
+`
+
+// MigrationsPath returns the directory of the migrations the server runs
+func MigrationsPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "db", "migrations")
+}
+
+// New creates a migrated database in a temporary directory and loads the
+// Fixtures. The database is closed when the test ends.
+func New(t testing.TB) *models.DB {
+	t.Helper()
+
+	db, err := models.NewDB(filepath.Join(t.TempDir(), "words.test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator := dbmigrate.NewMigrationManager(db.DB)
+	if err := migrator.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize migrations: %v", err)
+	}
+	migrations, err := migrator.LoadMigrations(MigrationsPath())
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if err := migrator.ApplyMigrations(migrations); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	if _, err := db.Exec(Fixtures); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObserveQuery(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "GET /api/words")
+	start := time.Now().Add(-time.Millisecond)
+	ObserveQuery(ctx, "WordService", `
+		SELECT id
+		FROM words
+	`, start, nil)
+	ObserveQuery(ctx, "WordService", "update words SET term = ?", start, errors.New("database is locked"))
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans; got %d", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "sqlite SELECT" || query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected a SELECT span under the request span; got %q", query.Name())
+	}
+	if !query.StartTime().Equal(start) {
+		t.Errorf("Expected the span to start with the query")
+	}
+	for _, attr := range query.Attributes() {
+		if attr.Key == "db.statement" && attr.Value.AsString() != "SELECT id FROM words" {
+			t.Errorf("Expected a compacted statement; got %q", attr.Value.AsString())
+		}
+	}
+	if failed := spans[1]; failed.Name() != "sqlite UPDATE" || failed.Status().Code != codes.Error {
+		t.Errorf("Expected a failed UPDATE span; got %q with status %v", failed.Name(), failed.Status())
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "zipkin"); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+	shutdown, err := Setup(context.Background(), ExporterNone)
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("Expected tracing to be disabled without errors; got %v", err)
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/magefile/mage/mg"
 	"github.com/magefile/mage/sh"
 	_ "github.com/mattn/go-sqlite3"
+	dbmigrate "lang-portal/internal/db"
 	"lang-portal/internal/models"
 )
 
@@ -39,7 +41,19 @@ func Run() error {
 func Build() error {
 	mg.Deps(Install)
 	fmt.Println("Building...")
-	return sh.Run("go", "build", "-o", "bin/server", "./cmd/server")
+	return sh.Run("go", "build", "-ldflags", versionLDFlags(), "-o", "bin/server", "./cmd/server")
+}
+
+// versionLDFlags embeds the version, commit and build time served at /version
+func versionLDFlags() string {
+	pkg := "lang-portal/internal/version"
+	version, err := sh.Output("git", "describe", "--tags", "--always", "--dirty")
+	if err != nil {
+		version = "dev"
+	}
+	commit, _ := sh.Output("git", "rev-parse", "HEAD")
+	return fmt.Sprintf("-X %s.Version=%s -X %s.Commit=%s -X %s.BuildTime=%s",
+		pkg, version, pkg, commit, pkg, time.Now().UTC().Format(time.RFC3339))
 }
 
 // InitDB initializes the database and runs migrations
@@ -53,63 +67,31 @@ func InitDB() error {
 	}
 	defer db.Close()
 
-	// Create tables
-	schema := `
-	CREATE TABLE IF NOT EXISTS words (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		japanese TEXT NOT NULL,
-		romaji TEXT NOT NULL,
-		english TEXT NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS groups (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS words_groups (
-		word_id INTEGER NOT NULL,
-		group_id INTEGER NOT NULL,
-		PRIMARY KEY (word_id, group_id),
-		FOREIGN KEY (word_id) REFERENCES words(id),
-		FOREIGN KEY (group_id) REFERENCES groups(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS study_activities (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		thumbnail_url TEXT,
-		description TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS study_sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		group_id INTEGER NOT NULL,
-		study_activity_id INTEGER NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (group_id) REFERENCES groups(id),
-		FOREIGN KEY (study_activity_id) REFERENCES study_activities(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS word_review_items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		word_id INTEGER NOT NULL,
-		study_session_id INTEGER NOT NULL,
-		correct BOOLEAN NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (word_id) REFERENCES words(id),
-		FOREIGN KEY (study_session_id) REFERENCES study_sessions(id)
-	);
-	`
-
-	if _, err := db.Exec(schema); err != nil {
-		return fmt.Errorf("failed to create tables: %v", err)
+	if err := migrate(db); err != nil {
+		return err
 	}
 
 	fmt.Println("Database initialization completed successfully")
 	return nil
 }
 
+// migrate applies the pending migrations of db/migrations, as the server does
+// at startup
+func migrate(db *models.DB) error {
+	migrator := dbmigrate.NewMigrationManager(db.DB)
+	if err := migrator.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize migrations: %v", err)
+	}
+	migrations, err := migrator.LoadMigrations("db/migrations")
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %v", err)
+	}
+	if err := migrator.ApplyMigrations(migrations); err != nil {
+		return fmt.Errorf("failed to apply migrations: %v", err)
+	}
+	return nil
+}
+
 // Seed seeds the database with initial data from JSON files
 func Seed() error {
 	fmt.Println("Seeding database...")
@@ -123,11 +105,11 @@ func Seed() error {
 
 	// Insert seed data
 	if _, err := db.Exec(`
-		INSERT INTO words (japanese, romaji, english)
-		VALUES 
-		('こんにちは', 'konnichiwa', 'hello'),
-		('さようなら', 'sayounara', 'goodbye'),
-		('ありがとう', 'arigatou', 'thank you')
+		INSERT INTO words (language, term, transliteration, meaning)
+		VALUES
+		('ja', 'こんにちは', 'konnichiwa', 'hello'),
+		('ja', 'さようなら', 'sayounara', 'goodbye'),
+		('ja', 'ありがとう', 'arigatou', 'thank you')
 	`); err != nil {
 		return fmt.Errorf("failed to seed database: %v", err)
 	}
@@ -167,13 +149,8 @@ func TestDB() error {
 	defer db.Close()
 
 	// Apply schema
-	schema, err := os.ReadFile("db/migrations/001_initial_schema.sql")
-	if err != nil {
-		return fmt.Errorf("failed to read schema: %v", err)
-	}
-
-	if _, err := db.Exec(string(schema)); err != nil {
-		return fmt.Errorf("failed to apply schema: %v", err)
+	if err := migrate(db); err != nil {
+		return err
 	}
 
 	// Apply test data